@@ -0,0 +1,264 @@
+package addresses
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAddressNotFound = errors.New("address not found")
+	ErrInvalidCountry  = errors.New("country must be an ISO 3166 alpha-2 code")
+	ErrNoAddress       = errors.New("a shipping address is required")
+)
+
+func GetAddresses(userID string) ([]*model.Address, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []models.Address
+	if err := utils.DB.Where("user_id = ?", userUUID).
+		Order("is_default DESC, created_at").
+		Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Address, len(addresses))
+	for i, address := range addresses {
+		result[i] = address.ToGraphQL()
+	}
+
+	return result, nil
+}
+
+func AddAddress(userID string, input model.AddressInput) (*model.Address, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := models.Address{UserID: userUUID}
+	if err := applyInput(&address, input); err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// A customer's first address is their default
+	var count int64
+	if err := tx.Model(&models.Address{}).Where("user_id = ?", userUUID).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if count == 0 {
+		address.IsDefault = true
+	}
+
+	if address.IsDefault {
+		if err := clearDefault(tx, userUUID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Create(&address).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return address.ToGraphQL(), nil
+}
+
+func UpdateAddress(userID string, id string, input model.AddressInput) (*model.Address, error) {
+	address, err := findAddress(utils.DB, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDefault := address.IsDefault
+	if err := applyInput(address, input); err != nil {
+		return nil, err
+	}
+	// The default moves by making another address the default, so it
+	// can't simply be switched off
+	if wasDefault {
+		address.IsDefault = true
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if address.IsDefault && !wasDefault {
+		if err := clearDefault(tx, address.UserID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Save(address).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return address.ToGraphQL(), nil
+}
+
+// DeleteAddress removes an address. Orders keep their own copy, so this
+// never affects past orders. If it was the default, the most recently
+// added remaining address takes over.
+func DeleteAddress(userID string, id string) (bool, error) {
+	address, err := findAddress(utils.DB, userID, id)
+	if err != nil {
+		return false, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Delete(address).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if address.IsDefault {
+		if err := promoteDefault(tx, address.UserID); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ForOrder resolves the address an order ships to: the given one, which must
+// belong to the user, or else their default address
+func ForOrder(tx *gorm.DB, userID string, addressID *string) (*models.Address, error) {
+	if addressID != nil && *addressID != "" {
+		return findAddress(tx, userID, *addressID)
+	}
+
+	var address models.Address
+	if err := tx.Where("user_id = ? AND is_default", userID).First(&address).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoAddress
+		}
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+func applyInput(address *models.Address, input model.AddressInput) error {
+	country := utils.NormalizeCountry(input.Country)
+	if len(country) != 2 {
+		return ErrInvalidCountry
+	}
+
+	address.Label = ""
+	if input.Label != nil {
+		address.Label = strings.TrimSpace(*input.Label)
+	}
+	address.PostalAddress = models.PostalAddress{
+		Recipient:   strings.TrimSpace(input.Recipient),
+		PhoneNumber: strings.TrimSpace(input.PhoneNumber),
+		Line1:       strings.TrimSpace(input.Line1),
+		City:        strings.TrimSpace(input.City),
+		Country:     country,
+	}
+	if input.Line2 != nil {
+		address.Line2 = strings.TrimSpace(*input.Line2)
+	}
+	if input.Region != nil {
+		address.Region = strings.TrimSpace(*input.Region)
+	}
+	if input.PostalCode != nil {
+		address.PostalCode = strings.TrimSpace(*input.PostalCode)
+	}
+	if input.IsDefault != nil {
+		address.IsDefault = *input.IsDefault
+	}
+
+	return nil
+}
+
+func clearDefault(tx *gorm.DB, userUUID uuid.UUID) error {
+	return tx.Model(&models.Address{}).
+		Where("user_id = ? AND is_default", userUUID).
+		Update("is_default", false).Error
+}
+
+// promoteDefault makes the newest address the default if the user has none
+func promoteDefault(tx *gorm.DB, userUUID uuid.UUID) error {
+	var count int64
+	if err := tx.Model(&models.Address{}).
+		Where("user_id = ? AND is_default", userUUID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var newest models.Address
+	err := tx.Where("user_id = ?", userUUID).Order("created_at DESC").First(&newest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&newest).Update("is_default", true).Error
+}
+
+// findAddress loads an address and verifies it belongs to the user
+func findAddress(db *gorm.DB, userID string, id string) (*models.Address, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	addressUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var address models.Address
+	if err := db.Where("id = ? AND user_id = ?", addressUUID, userUUID).First(&address).Error; err != nil {
+		return nil, ErrAddressNotFound
+	}
+
+	return &address, nil
+}
@@ -0,0 +1,288 @@
+package carts
+
+import (
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/engine/orders"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCartEmpty        = errors.New("cart is empty")
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrInvalidQuantity  = errors.New("quantity must be greater than 0")
+)
+
+// getOrCreateCart returns the user's cart, creating an empty one on first use
+func getOrCreateCart(db *gorm.DB, userUUID uuid.UUID) (*models.Cart, error) {
+	var cart models.Cart
+	err := db.Where("user_id = ?", userUUID).First(&cart).Error
+	if err == nil {
+		return &cart, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	cart = models.Cart{UserID: userUUID}
+	if err := db.Create(&cart).Error; err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+func loadCart(cartID uuid.UUID) (*model.Cart, error) {
+	var cart models.Cart
+	if err := utils.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Preload("Items.Product.Categories").
+		Preload("Items.Variant.OptionValues.Option").
+		First(&cart, "id = ?", cartID).Error; err != nil {
+		return nil, err
+	}
+
+	result := cart.ToGraphQL()
+	total, err := cartTotal(result.Items)
+	if err != nil {
+		return nil, err
+	}
+	result.Total = total
+
+	return result, nil
+}
+
+// cartTotal adds up the items in the first item's currency, converting any
+// priced in another currency at the current rate, as checkout would
+func cartTotal(items []*model.CartItem) (model.Money, error) {
+	currency := model.DefaultCurrency()
+	if len(items) > 0 {
+		currency = items[0].SubTotal.Currency
+	}
+
+	total := model.NewMoney(0, currency)
+	for _, item := range items {
+		subTotal, _, err := currencies.Convert(utils.DB, item.SubTotal, currency)
+		if err != nil {
+			return model.Money{}, err
+		}
+		if total, err = total.Add(subTotal); err != nil {
+			return model.Money{}, err
+		}
+	}
+
+	return total, nil
+}
+
+func GetCart(userID string) (*model.Cart, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := getOrCreateCart(utils.DB, userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadCart(cart.ID)
+}
+
+func AddToCart(userID string, productID string, variantID *string, quantity int) (*model.Cart, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var product models.Product
+	if err := inventory.ListedProducts(utils.DB).First(&product, "id = ?", productUUID).Error; err != nil {
+		return nil, err
+	}
+
+	variants, err := inventory.ResolveVariants(utils.DB, []uuid.UUID{productUUID}, []*string{variantID})
+	if err != nil {
+		return nil, err
+	}
+	variant := variants[0]
+
+	cart, err := getOrCreateCart(utils.DB, userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge with an existing line for the same product and variant
+	query := utils.DB.Where("cart_id = ? AND product_id = ?", cart.ID, productUUID)
+	if variant != nil {
+		query = query.Where("variant_id = ?", variant.ID)
+	} else {
+		query = query.Where("variant_id IS NULL")
+	}
+
+	var item models.CartItem
+	err = query.First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err == nil {
+		item.Quantity += quantity
+	} else {
+		item = models.CartItem{
+			CartID:    cart.ID,
+			ProductID: productUUID,
+			Quantity:  quantity,
+		}
+		if variant != nil {
+			item.VariantID = &variant.ID
+		}
+	}
+
+	// Stock is only reserved at checkout, but don't let the cart ask for more than exists
+	stock := product.Stock
+	if variant != nil {
+		stock = variant.Stock
+	}
+	if item.Quantity > stock {
+		return nil, errors.New("insufficient stock for product: " + product.Name)
+	}
+
+	if err := utils.DB.Save(&item).Error; err != nil {
+		return nil, err
+	}
+
+	return loadCart(cart.ID)
+}
+
+func UpdateCartItem(userID string, itemID string, quantity int) (*model.Cart, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	item, err := findCartItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	var product models.Product
+	if err := utils.DB.First(&product, "id = ?", item.ProductID).Error; err != nil {
+		return nil, err
+	}
+
+	stock := product.Stock
+	if item.VariantID != nil {
+		var variant models.ProductVariant
+		if err := utils.DB.First(&variant, "id = ?", item.VariantID).Error; err != nil {
+			return nil, err
+		}
+		stock = variant.Stock
+	}
+
+	if quantity > stock {
+		return nil, errors.New("insufficient stock for product: " + product.Name)
+	}
+
+	item.Quantity = quantity
+	if err := utils.DB.Save(item).Error; err != nil {
+		return nil, err
+	}
+
+	return loadCart(item.CartID)
+}
+
+func RemoveFromCart(userID string, itemID string) (*model.Cart, error) {
+	item, err := findCartItem(userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.DB.Delete(item).Error; err != nil {
+		return nil, err
+	}
+
+	return loadCart(item.CartID)
+}
+
+// CheckoutCart turns the user's cart into an order. The cart is emptied in
+// the same transaction as the order, so a failed checkout leaves it intact.
+func CheckoutCart(userID string, checkout *model.CheckoutInput) (*model.Order, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cart models.Cart
+	if err := utils.DB.Preload("Items").Where("user_id = ?", userUUID).First(&cart).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartEmpty
+		}
+		return nil, err
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	input := model.OrderInput{
+		Items: make([]*model.OrderItemInput, len(cart.Items)),
+	}
+	if checkout != nil {
+		input.Currency = checkout.Currency
+		input.CouponCode = checkout.CouponCode
+		input.ShippingAddressID = checkout.ShippingAddressID
+		input.ShippingMethodID = checkout.ShippingMethodID
+	}
+	itemIDs := make([]uuid.UUID, len(cart.Items))
+	for i, item := range cart.Items {
+		itemIDs[i] = item.ID
+		input.Items[i] = &model.OrderItemInput{
+			ProductID: item.ProductID.String(),
+			Quantity:  int32(item.Quantity),
+		}
+		if item.VariantID != nil {
+			variantID := item.VariantID.String()
+			input.Items[i].VariantID = &variantID
+		}
+	}
+
+	return orders.CreateOrderWithHook(input, userID, func(tx *gorm.DB, order *models.Order) error {
+		// Only the items that were ordered; any added since stay in the cart
+		return tx.Where("id IN ?", itemIDs).Delete(&models.CartItem{}).Error
+	})
+}
+
+// findCartItem loads a cart item and verifies it belongs to the user's cart
+func findCartItem(userID string, itemID string) (*models.CartItem, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	itemUUID, err := uuid.FromString(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.CartItem
+	if err := utils.DB.Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("cart_items.id = ? AND carts.user_id = ?", itemUUID, userUUID).
+		First(&item).Error; err != nil {
+		return nil, ErrCartItemNotFound
+	}
+
+	return &item, nil
+}
@@ -5,8 +5,21 @@ import (
 	"ecommerce-service/models"
 	"ecommerce-service/utils"
 	"errors"
+	"fmt"
 
 	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Root categories are level 0, so this allows five levels
+const maxCategoryLevel = 4
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryNotEmpty = errors.New("category has subcategories or products")
+	ErrCategoryCycle    = errors.New("category cannot be moved under itself or its subcategories")
+	ErrCategoryTooDeep  = errors.New("maximum category nesting level would be exceeded")
 )
 
 func CreateCategory(input model.CategoryInput) (*model.Category, error) {
@@ -27,7 +40,7 @@ func CreateCategory(input model.CategoryInput) (*model.Category, error) {
 		}
 
 		// Prevent deep nesting (more than 5 levels)
-		if parent.Level >= 4 {
+		if parent.Level >= maxCategoryLevel {
 			return nil, errors.New("maximum category nesting level reached")
 		}
 
@@ -69,52 +82,102 @@ func GetCategoryByID(id string) (*model.Category, error) {
 	return category.ToGraphQL(), nil
 }
 
+// UpdateCategory renames a category and moves it, with its subtree, under a
+// new parent. The move is rejected if the parent is inside the subtree or
+// if the subtree's deepest category would go past the nesting limit.
 func UpdateCategory(id string, input model.CategoryInput) (*model.Category, error) {
 	catUUID, err := uuid.FromString(id)
 	if err != nil {
 		return nil, err
 	}
 
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
 	var category models.Category
-	if err := utils.DB.First(&category, "id = ?", catUUID).Error; err != nil {
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, "id = ?", catUUID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 
-	// Update the name
-	category.Name = input.Name
+	var parentID *uuid.UUID
+	level := 0
 
 	// Update parent if provided
 	if input.ParentID != nil {
 		parentUUID, err := uuid.FromString(*input.ParentID)
 		if err != nil {
+			tx.Rollback()
 			return nil, err
 		}
 
-		// Verify parent exists
+		// Verify parent exists. Locking it too means a concurrent move in
+		// the other direction waits and then sees this one.
 		var parent models.Category
-		if err := utils.DB.First(&parent, "id = ?", parentUUID).Error; err != nil {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&parent, "id = ?", parentUUID).Error; err != nil {
+			tx.Rollback()
 			return nil, err
 		}
 
-		// Check for circular reference
-		if parent.ID == category.ID {
-			return nil, errors.New("category cannot be its own parent")
+		// The parent can't be the category itself or anything below it
+		var inSubtree int64
+		if err := tx.Raw("SELECT COUNT(*) FROM (?) AS subtree WHERE id = ?",
+			SubtreeIDs(tx, catUUID), parentUUID).Scan(&inSubtree).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if inSubtree > 0 {
+			tx.Rollback()
+			return nil, ErrCategoryCycle
 		}
 
-		// Check if new parent would create too deep nesting
-		if parent.Level >= 4 {
-			return nil, errors.New("maximum category nesting level would be exceeded")
+		parentID = &parentUUID
+		level = parent.Level + 1
+	}
+
+	// The deepest descendant moves by as much as the category does
+	var deepest int
+	if err := tx.Model(&models.Category{}).
+		Select("COALESCE(MAX(level), 0)").
+		Where("id IN (?)", SubtreeIDs(tx, catUUID)).
+		Scan(&deepest).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	shift := level - category.Level
+	if deepest+shift > maxCategoryLevel {
+		tx.Rollback()
+		return nil, ErrCategoryTooDeep
+	}
+
+	if shift != 0 {
+		if err := tx.Model(&models.Category{}).
+			Where("id IN (?) AND id <> ?", SubtreeIDs(tx, catUUID), catUUID).
+			Update("level", gorm.Expr("level + ?", shift)).Error; err != nil {
+			tx.Rollback()
+			return nil, err
 		}
+	}
 
-		category.ParentID = &parentUUID
-		category.Level = parent.Level + 1
-	} else {
-		category.ParentID = nil
-		category.Level = 0
+	if err := tx.Model(&models.Category{}).Where("id = ?", catUUID).Updates(map[string]interface{}{
+		"name":      input.Name,
+		"parent_id": parentID,
+		"level":     level,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
-	// Save updates
-	if err := utils.DB.Save(&category).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
 
@@ -125,3 +188,112 @@ func UpdateCategory(id string, input model.CategoryInput) (*model.Category, erro
 
 	return category.ToGraphQL(), nil
 }
+
+// DeleteCategory removes a category. With REJECT it must have no
+// subcategories or products; REPARENT moves them up to its parent (products
+// of a root category are just unlinked); CASCADE removes the whole subtree
+// and unlinks its products. Products themselves are never deleted.
+func DeleteCategory(id string, strategy model.CategoryDeleteStrategy) (bool, error) {
+	catUUID, err := uuid.FromString(id)
+	if err != nil {
+		return false, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var category models.Category
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, "id = ?", catUUID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		return false, ErrCategoryNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	// Categories removed along with this one
+	removed := []uuid.UUID{catUUID}
+
+	switch strategy {
+	case model.CategoryDeleteStrategyReject:
+		var children, products int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", catUUID).Count(&children).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if err := tx.Table("category_products").Where("category_id = ?", catUUID).Count(&products).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if children > 0 || products > 0 {
+			tx.Rollback()
+			return false, ErrCategoryNotEmpty
+		}
+
+	case model.CategoryDeleteStrategyReparent:
+		// Every descendant moves up one level
+		if err := tx.Model(&models.Category{}).
+			Where("id IN (?) AND id <> ?", SubtreeIDs(tx, catUUID), catUUID).
+			Update("level", gorm.Expr("level - 1")).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if err := tx.Model(&models.Category{}).
+			Where("parent_id = ?", catUUID).
+			Update("parent_id", category.ParentID).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+
+		if category.ParentID != nil {
+			if err := tx.Exec(`INSERT INTO category_products (category_id, product_id)
+				SELECT ?, product_id FROM category_products WHERE category_id = ?
+				ON CONFLICT DO NOTHING`, *category.ParentID, catUUID).Error; err != nil {
+				tx.Rollback()
+				return false, err
+			}
+		}
+
+	case model.CategoryDeleteStrategyCascade:
+		var subtree []uuid.UUID
+		if err := SubtreeIDs(tx, catUUID).Scan(&subtree).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		removed = subtree
+
+	default:
+		tx.Rollback()
+		return false, fmt.Errorf("unsupported delete strategy: %s", strategy)
+	}
+
+	// Links to the removed categories go with them, including tax rates that
+	// only applied to them
+	for _, statement := range []string{
+		"DELETE FROM category_products WHERE category_id IN ?",
+		"DELETE FROM promotion_categories WHERE category_id IN ?",
+		"DELETE FROM tax_rates WHERE category_id IN ?",
+	} {
+		if err := tx.Exec(statement, removed).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Where("id IN ?", removed).Delete(&models.Category{}).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
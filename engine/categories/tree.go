@@ -0,0 +1,100 @@
+package categories
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// SubtreeIDs selects the IDs of the categories and all of their descendants,
+// for use as a subquery: Where("category_id IN (?)", SubtreeIDs(db, id))
+func SubtreeIDs(db *gorm.DB, categoryIDs ...uuid.UUID) *gorm.DB {
+	return db.Raw(`WITH RECURSIVE subtree AS (
+		SELECT id FROM categories WHERE id IN ?
+		UNION ALL
+		SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+	) SELECT id FROM subtree`, categoryIDs)
+}
+
+// GetCategoryTree loads the whole hierarchy in one query and returns the
+// root categories with their children nested to every level
+func GetCategoryTree() ([]*model.Category, error) {
+	var categories []models.Category
+	if err := utils.DB.Raw(`WITH RECURSIVE tree AS (
+		SELECT * FROM categories WHERE parent_id IS NULL
+		UNION ALL
+		SELECT categories.* FROM categories JOIN tree ON categories.parent_id = tree.id
+	) SELECT * FROM tree ORDER BY level, name`).Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	// Parents come before their children, so each child's parent is
+	// already in the map
+	roots := make([]*model.Category, 0)
+	byID := make(map[string]*model.Category, len(categories))
+	for _, category := range categories {
+		node := category.ToGraphQL()
+		byID[node.ID] = node
+
+		if node.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := byID[*node.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	return roots, nil
+}
+
+// GetAncestors returns the path from the root category down to the
+// category's parent, for breadcrumbs
+func GetAncestors(id string) ([]*model.Category, error) {
+	catUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.Category
+	if err := utils.DB.Raw(`WITH RECURSIVE ancestors AS (
+		SELECT categories.* FROM categories
+		WHERE id = (SELECT parent_id FROM categories WHERE id = ?)
+		UNION ALL
+		SELECT categories.* FROM categories JOIN ancestors ON categories.id = ancestors.parent_id
+	) SELECT * FROM ancestors ORDER BY level`, catUUID).Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQL(categories), nil
+}
+
+// GetDescendants returns every category below the given one, shallowest
+// first
+func GetDescendants(id string) ([]*model.Category, error) {
+	catUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.Category
+	if err := utils.DB.Where("id IN (?) AND id <> ?", SubtreeIDs(utils.DB, catUUID), catUUID).
+		Order("level").
+		Order("name").
+		Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	return toGraphQL(categories), nil
+}
+
+func toGraphQL(categories []models.Category) []*model.Category {
+	result := make([]*model.Category, len(categories))
+	for i, category := range categories {
+		result[i] = category.ToGraphQL()
+	}
+	return result
+}
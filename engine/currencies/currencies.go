@@ -0,0 +1,231 @@
+package currencies
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoExchangeRate  = errors.New("no exchange rate available")
+	ErrInvalidRate     = errors.New("exchange rate must be a positive decimal")
+	ErrInvalidCurrency = errors.New("currency must be an ISO 4217 code")
+)
+
+// Currency used in each market, keyed by ISO 3166 alpha-2 code
+var countryCurrencies = map[string]string{
+	"KE": "KES",
+	"UG": "UGX",
+	"TZ": "TZS",
+	"RW": "RWF",
+	"NG": "NGN",
+	"ZA": "ZAR",
+	"GB": "GBP",
+	"US": "USD",
+	"DE": "EUR",
+	"FR": "EUR",
+	"NL": "EUR",
+}
+
+// CurrencyForCountry maps a customer's country to the currency prices are
+// shown in, falling back to the default currency for unknown markets
+func CurrencyForCountry(country string) string {
+	if currency, ok := countryCurrencies[utils.NormalizeCountry(country)]; ok {
+		return currency
+	}
+	return model.DefaultCurrency()
+}
+
+// DisplayCurrency picks the currency for a request: the explicit argument if
+// given, otherwise the one for the viewer's country. A country whose
+// currency has no rate from the catalogue currency yet falls back to the
+// catalogue currency rather than failing the request.
+func DisplayCurrency(requested *string, country string) (string, error) {
+	if requested == nil || *requested == "" {
+		currency := CurrencyForCountry(country)
+		_, err := GetRate(utils.DB, model.DefaultCurrency(), currency)
+		if errors.Is(err, ErrNoExchangeRate) {
+			return model.DefaultCurrency(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return currency, nil
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(*requested))
+	if !model.IsCurrency(currency) {
+		return "", ErrInvalidCurrency
+	}
+	return currency, nil
+}
+
+// GetRate returns how many units of to one unit of from buys. A stored rate
+// for the reverse pair is inverted if there is no direct one.
+func GetRate(db *gorm.DB, from string, to string) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	var rates []models.ExchangeRate
+	if err := db.Where(
+		"(base_currency = ? AND quote_currency = ?) OR (base_currency = ? AND quote_currency = ?)",
+		from, to, to, from,
+	).Find(&rates).Error; err != nil {
+		return nil, err
+	}
+
+	var inverse *big.Rat
+	for _, rate := range rates {
+		value, ok := new(big.Rat).SetString(rate.Rate)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("corrupt exchange rate %s/%s: %q", rate.BaseCurrency, rate.QuoteCurrency, rate.Rate)
+		}
+
+		if rate.BaseCurrency == from {
+			return value, nil
+		}
+		inverse = new(big.Rat).Inv(value)
+	}
+
+	if inverse != nil {
+		return inverse, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s to %s", ErrNoExchangeRate, from, to)
+}
+
+// Convert converts amount into the target currency and returns the rate used
+func Convert(db *gorm.DB, amount model.Money, to string) (model.Money, *big.Rat, error) {
+	rate, err := GetRate(db, amount.Currency, to)
+	if err != nil {
+		return model.Money{}, nil, err
+	}
+
+	return convertAt(amount, rate, to), rate, nil
+}
+
+// convertAt converts amount at a rate between whole units. Amounts are in
+// minor units, so the rate is rescaled when the currencies have different
+// numbers of decimal places, e.g. USD cents to whole UGX.
+func convertAt(amount model.Money, rate *big.Rat, to string) model.Money {
+	scaled := new(big.Rat).Set(rate)
+	ten := big.NewRat(10, 1)
+	for shift := model.CurrencyExponent(to) - model.CurrencyExponent(amount.Currency); shift != 0; {
+		if shift > 0 {
+			scaled.Mul(scaled, ten)
+			shift--
+		} else {
+			scaled.Quo(scaled, ten)
+			shift++
+		}
+	}
+
+	converted := amount.MulRat(scaled)
+	converted.Currency = to
+	return converted
+}
+
+// ConvertProducts rewrites the display price of each product and its
+// variants into the target currency. BasePrice keeps the catalogue price,
+// which is also shown for products priced in a currency with no rate to the
+// target.
+func ConvertProducts(products []*model.Product, to string) error {
+	rates := make(map[string]*big.Rat)
+	convert := func(base model.Money) (model.Money, error) {
+		rate, ok := rates[base.Currency]
+		if !ok {
+			var err error
+			rate, err = GetRate(utils.DB, base.Currency, to)
+			if errors.Is(err, ErrNoExchangeRate) {
+				rate = nil
+			} else if err != nil {
+				return model.Money{}, err
+			}
+			rates[base.Currency] = rate
+		}
+
+		if rate == nil {
+			return base, nil
+		}
+		return convertAt(base, rate, to), nil
+	}
+
+	for _, product := range products {
+		var err error
+		product.Price, err = convert(product.BasePrice)
+		if err != nil {
+			return err
+		}
+
+		for _, variant := range product.Variants {
+			variant.Price, err = convert(variant.BasePrice)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FormatRate renders a rate the way it is stored
+func FormatRate(rate *big.Rat) string {
+	formatted := strings.TrimRight(rate.FloatString(10), "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+func SetExchangeRate(baseCurrency string, quoteCurrency string, rate string) (*model.ExchangeRate, error) {
+	baseCurrency = strings.ToUpper(strings.TrimSpace(baseCurrency))
+	quoteCurrency = strings.ToUpper(strings.TrimSpace(quoteCurrency))
+	if !model.IsCurrency(baseCurrency) || !model.IsCurrency(quoteCurrency) || baseCurrency == quoteCurrency {
+		return nil, ErrInvalidCurrency
+	}
+
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || value.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	exchangeRate := models.ExchangeRate{
+		BaseCurrency:  baseCurrency,
+		QuoteCurrency: quoteCurrency,
+		Rate:          FormatRate(value),
+	}
+
+	// Replace the rate for this pair if one already exists
+	if err := utils.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&exchangeRate).Error; err != nil {
+		return nil, err
+	}
+
+	if err := utils.DB.Where("base_currency = ? AND quote_currency = ?", baseCurrency, quoteCurrency).
+		First(&exchangeRate).Error; err != nil {
+		return nil, err
+	}
+
+	return exchangeRate.ToGraphQL(), nil
+}
+
+func GetExchangeRates() ([]*model.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	if err := utils.DB.Order("base_currency, quote_currency").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.ExchangeRate, len(rates))
+	for i, rate := range rates {
+		result[i] = rate.ToGraphQL()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package currencies
+
+import (
+	"ecommerce-service/graph/model"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestConvertAtRescalesMinorUnits(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount model.Money
+		rate   string
+		to     string
+		want   model.Money
+	}{
+		{"same exponent", model.NewMoney(1000, "USD"), "129.5", "KES", model.NewMoney(129500, "KES")},
+		{"to zero decimals", model.NewMoney(1999, "USD"), "3700", "UGX", model.NewMoney(73963, "UGX")},
+		{"from zero decimals", model.NewMoney(3700, "UGX"), "0.00027027027", "USD", model.NewMoney(100, "USD")},
+		{"to three decimals", model.NewMoney(1000, "USD"), "0.307", "KWD", model.NewMoney(3070, "KWD")},
+		{"from three decimals", model.NewMoney(3070, "KWD"), "3.2573", "USD", model.NewMoney(1000, "USD")},
+		{"zero to three decimals", model.NewMoney(10000, "UGX"), "0.000083", "KWD", model.NewMoney(830, "KWD")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(test.rate)
+			if !ok {
+				t.Fatalf("bad rate %q", test.rate)
+			}
+			if got := convertAt(test.amount, rate, test.to); got != test.want {
+				t.Errorf("convertAt(%s, %s, %s) = %s, want %s", test.amount, test.rate, test.to, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisplayCurrencyValidatesRequestedCode(t *testing.T) {
+	for _, code := range []string{"usd", " KES ", "UGX"} {
+		code := code
+		if _, err := DisplayCurrency(&code, "KE"); err != nil {
+			t.Errorf("DisplayCurrency(%q) returned %v", code, err)
+		}
+	}
+
+	for _, code := range []string{"XYZ", "US", "DOLLARS", "123"} {
+		code := code
+		if _, err := DisplayCurrency(&code, "KE"); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("DisplayCurrency(%q) returned %v, want ErrInvalidCurrency", code, err)
+		}
+	}
+}
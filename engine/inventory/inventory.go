@@ -0,0 +1,381 @@
+package inventory
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrProductNotFound   = errors.New("product not found")
+	ErrZeroDelta         = errors.New("stock adjustment must not be zero")
+	ErrReasonNotManual   = errors.New("stock movements with this reason are recorded automatically")
+	ErrAlreadyReconciled = errors.New("stock already matches the ledger")
+	ErrVariantNotFound   = errors.New("variant not found for this product")
+	ErrVariantRequired   = errors.New("choose one of the product's variants")
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// LockProducts loads the given products with SELECT ... FOR UPDATE. Rows are
+// locked in primary key order, so two transactions locking overlapping sets
+// always acquire them in the same order and can't deadlock. Duplicate IDs are
+// fine; a missing product is an error.
+func LockProducts(tx *gorm.DB, productIDs []uuid.UUID) (map[uuid.UUID]models.Product, error) {
+	unique := make(map[uuid.UUID]struct{}, len(productIDs))
+	for _, id := range productIDs {
+		unique[id] = struct{}{}
+	}
+
+	ids := make([]uuid.UUID, 0, len(unique))
+	for id := range unique {
+		ids = append(ids, id)
+	}
+
+	var products []models.Product
+	if len(ids) > 0 {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&products).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(products) != len(ids) {
+		return nil, ErrProductNotFound
+	}
+
+	result := make(map[uuid.UUID]models.Product, len(products))
+	for _, product := range products {
+		result[product.ID] = product
+	}
+
+	return result, nil
+}
+
+// ApplyMovement changes the product's stock by movement.Delta and appends the
+// movement to the ledger. The stock update is a single conditional statement,
+// so it never takes stock below zero. Call it inside a transaction so the
+// ledger entry and the stock change commit together.
+//
+// Movements for a variant change the variant's stock as well, keeping the
+// product's stock the sum of its variants'.
+func ApplyMovement(tx *gorm.DB, movement *models.InventoryMovement) error {
+	if movement.VariantID != nil {
+		result := tx.Model(&models.ProductVariant{}).
+			Where("id = ? AND product_id = ? AND stock + ? >= 0", movement.VariantID, movement.ProductID, movement.Delta).
+			Update("stock", gorm.Expr("stock + ?", movement.Delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+	}
+
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock + ? >= 0", movement.ProductID, movement.Delta).
+		Update("stock", gorm.Expr("stock + ?", movement.Delta))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+
+	return tx.Create(movement).Error
+}
+
+// ResolveVariants checks the variant chosen for each line against the line's
+// product and returns it, or nil for products without variants. Products
+// that have variants must be bought as one of them. Call it with the
+// products locked so the variants' stock can be relied on.
+func ResolveVariants(tx *gorm.DB, productIDs []uuid.UUID, variantIDs []*string) ([]*models.ProductVariant, error) {
+	var withVariants []uuid.UUID
+	if err := tx.Model(&models.ProductVariant{}).
+		Where("product_id IN ?", productIDs).
+		Distinct("product_id").
+		Pluck("product_id", &withVariants).Error; err != nil {
+		return nil, err
+	}
+	hasVariants := make(map[uuid.UUID]bool, len(withVariants))
+	for _, productID := range withVariants {
+		hasVariants[productID] = true
+	}
+
+	ids := make([]uuid.UUID, 0, len(variantIDs))
+	for _, variantID := range variantIDs {
+		if variantID == nil {
+			continue
+		}
+		variantUUID, err := uuid.FromString(*variantID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, variantUUID)
+	}
+
+	variants := make(map[uuid.UUID]*models.ProductVariant, len(ids))
+	if len(ids) > 0 {
+		var found []models.ProductVariant
+		if err := tx.Preload("OptionValues.Option").Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for i := range found {
+			variants[found[i].ID] = &found[i]
+		}
+	}
+
+	result := make([]*models.ProductVariant, len(productIDs))
+	for i, productID := range productIDs {
+		if variantIDs[i] == nil {
+			if hasVariants[productID] {
+				return nil, ErrVariantRequired
+			}
+			continue
+		}
+
+		variant, ok := variants[uuid.FromStringOrNil(*variantIDs[i])]
+		if !ok || variant.ProductID != productID {
+			return nil, ErrVariantNotFound
+		}
+		result[i] = variant
+	}
+
+	return result, nil
+}
+
+// AdjustStock records a manual stock movement (adjustment, goods receipt or
+// customer return) and applies it to the product, or to one of its variants.
+func AdjustStock(productID string, variantID *string, delta int, reason model.InventoryReason, note *string, actorID string) (*model.Product, error) {
+	if delta == 0 {
+		return nil, ErrZeroDelta
+	}
+
+	if !models.InventoryReason(reason).IsManual() {
+		return nil, ErrReasonNotManual
+	}
+
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	movement := models.InventoryMovement{
+		ProductID: productUUID,
+		Delta:     delta,
+		Reason:    models.InventoryReason(reason),
+		ActorID:   &actorUUID,
+	}
+	if note != nil {
+		movement.Note = *note
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := LockProducts(tx, []uuid.UUID{productUUID}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	variants, err := ResolveVariants(tx, []uuid.UUID{productUUID}, []*string{variantID})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if variants[0] != nil {
+		movement.VariantID = &variants[0].ID
+	}
+
+	if err := ApplyMovement(tx, &movement); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadProduct(productUUID)
+}
+
+// GetStockHistory returns the most recent ledger entries for a product
+func GetStockHistory(productID string, limit *int32) ([]*model.InventoryMovement, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	size := defaultHistoryLimit
+	if limit != nil && *limit > 0 {
+		size = int(*limit)
+	}
+	if size > maxHistoryLimit {
+		size = maxHistoryLimit
+	}
+
+	var movements []models.InventoryMovement
+	if err := utils.DB.Preload("Actor").
+		Where("product_id = ?", productUUID).
+		Order("created_at DESC").
+		Limit(size).
+		Find(&movements).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.InventoryMovement, len(movements))
+	for i, movement := range movements {
+		result[i] = movement.ToGraphQL()
+	}
+
+	return result, nil
+}
+
+type ledgerBalance struct {
+	ProductID   uuid.UUID
+	Stock       int
+	LedgerStock int
+}
+
+// ledgerBalances compares each product's stock column with the sum of its
+// ledger entries. Only products that disagree are returned.
+func ledgerBalances(db *gorm.DB) *gorm.DB {
+	return db.Table("products").
+		Select("products.id AS product_id, products.stock AS stock, COALESCE(SUM(inventory_movements.delta), 0) AS ledger_stock").
+		Joins("LEFT JOIN inventory_movements ON inventory_movements.product_id = products.id").
+		Group("products.id, products.stock").
+		Having("products.stock <> COALESCE(SUM(inventory_movements.delta), 0)")
+}
+
+// GetStockDiscrepancies lists products whose stock doesn't match their ledger
+func GetStockDiscrepancies() ([]*model.StockDiscrepancy, error) {
+	var balances []ledgerBalance
+	if err := ledgerBalances(utils.DB).Scan(&balances).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.StockDiscrepancy, 0, len(balances))
+	for _, balance := range balances {
+		product, err := loadProduct(balance.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &model.StockDiscrepancy{
+			Product:     product,
+			Stock:       int32(balance.Stock),
+			LedgerStock: int32(balance.LedgerStock),
+		})
+	}
+
+	return result, nil
+}
+
+// ReconcileStock writes a ledger-only RECONCILIATION entry so the ledger sums
+// to the product's current stock. The stock column itself is left untouched;
+// use AdjustStock to correct the physical count.
+func ReconcileStock(productID string, note *string, actorID string) (*model.Product, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := LockProducts(tx, []uuid.UUID{productUUID}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var balance ledgerBalance
+	result := ledgerBalances(tx).Where("products.id = ?", productUUID).Scan(&balance)
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrAlreadyReconciled
+	}
+
+	movement := models.InventoryMovement{
+		ProductID: productUUID,
+		Delta:     balance.Stock - balance.LedgerStock,
+		Reason:    models.InventoryReasonReconciliation,
+		ActorID:   &actorUUID,
+	}
+	if note != nil {
+		movement.Note = *note
+	}
+
+	if err := tx.Create(&movement).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadProduct(productUUID)
+}
+
+// ListedProducts limits a products query to those that haven't been
+// deleted. Deleted products keep their row for the ledger and past orders.
+func ListedProducts(db *gorm.DB) *gorm.DB {
+	return db.Where("products.deleted_at IS NULL")
+}
+
+// PreloadProduct loads the relations needed to render a product
+func PreloadProduct(db *gorm.DB) *gorm.DB {
+	return db.Preload("Categories").
+		Preload("Options", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Options.Values", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("Variants.OptionValues.Option")
+}
+
+func loadProduct(productUUID uuid.UUID) (*model.Product, error) {
+	var product models.Product
+	if err := PreloadProduct(utils.DB).First(&product, "id = ?", productUUID).Error; err != nil {
+		return nil, err
+	}
+
+	return product.ToGraphQL(), nil
+}
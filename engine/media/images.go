@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+const (
+	// MaxUploadBytes is the largest image accepted
+	MaxUploadBytes = 10 << 20
+	// Decoded size limit, so a small file can't expand into a huge bitmap
+	maxImagePixels = 40_000_000
+	// Thumbnails fit within a square of this many pixels
+	ThumbnailSize = 400
+)
+
+var (
+	ErrImageTooLarge    = errors.New("image is too large")
+	ErrUnsupportedImage = errors.New("image must be a JPEG, PNG or GIF")
+	ErrEmptyImage       = errors.New("image is empty")
+)
+
+// Image is an uploaded image, decoded and with its thumbnail rendered
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+
+	Thumbnail            []byte
+	ThumbnailContentType string
+	ThumbnailExtension   string
+}
+
+// ProcessImage reads an upload, checks that it is an image of a supported
+// format and size, and renders its thumbnail
+func ProcessImage(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyImage
+	}
+	if len(data) > MaxUploadBytes {
+		return nil, ErrImageTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	result := &Image{
+		Data:   data,
+		Width:  config.Width,
+		Height: config.Height,
+	}
+	switch format {
+	case "jpeg":
+		result.ContentType, result.Extension = "image/jpeg", ".jpg"
+	case "png":
+		result.ContentType, result.Extension = "image/png", ".png"
+	case "gif":
+		result.ContentType, result.Extension = "image/gif", ".gif"
+	default:
+		return nil, ErrUnsupportedImage
+	}
+
+	// PNG and GIF thumbnails stay PNG to keep transparency
+	thumbnail := resize(decoded, ThumbnailSize)
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85})
+		result.ThumbnailContentType, result.ThumbnailExtension = "image/jpeg", ".jpg"
+	} else {
+		err = png.Encode(&buf, thumbnail)
+		result.ThumbnailContentType, result.ThumbnailExtension = "image/png", ".png"
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Thumbnail = buf.Bytes()
+
+	return result, nil
+}
+
+// resize scales src down to fit within size x size, keeping its aspect
+// ratio. Each output pixel is the average of the source pixels it covers,
+// which is enough for downscaling photos.
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+		return dst
+	}
+
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = max(1, height*size/width)
+	} else {
+		dstWidth = max(1, width*size/height)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dstHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			x0 := bounds.Min.X + x*width/dstWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,119 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps uploaded files. Keys are slash-separated relative paths
+// such as products/<id>/<file>.jpg.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// URL is where clients can fetch the blob
+	URL(key string) string
+}
+
+// LocalStore keeps blobs on local disk under Root. The server exposes Root
+// as a static route at BaseURL.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStore(root string, baseURL string) *LocalStore {
+	return &LocalStore{
+		Root:    root,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Put writes to a temporary file first so a half-written blob is never
+// served
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp makes the file private
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// path maps a key to a file under Root, refusing keys that would escape it
+func (s *LocalStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Root, cleaned), nil
+}
+
+var store BlobStore
+
+// InitStore sets up the blob store from the environment. Files are kept on
+// local disk under MEDIA_ROOT and served from MEDIA_BASE_URL.
+func InitStore() {
+	store = NewLocalStore(LocalRoot(), envOrDefault("MEDIA_BASE_URL", "/media"))
+}
+
+// LocalRoot is the directory the local store writes to
+func LocalRoot() string {
+	return envOrDefault("MEDIA_ROOT", "./media")
+}
+
+// Store returns the configured blob store
+func Store() BlobStore {
+	return store
+}
+
+func envOrDefault(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -23,7 +23,7 @@ var gateway = &AfricasTalkingGateway{
 
 func SendOrderConfirmationSMS(order *models.Order) error {
 	message := fmt.Sprintf(
-		"Thank you for your order #%s. Total: $%.2f. We'll process it right away!",
+		"Thank you for your order #%s. Total: %s. We'll process it right away!",
 		order.ID.String()[:8],
 		order.Total,
 	)
@@ -55,13 +55,13 @@ New order received:
 
 Order ID: %s
 Customer: %s (%s)
-Total: $%.2f
+Total: %s
 
 Items:
 `, order.ID.String()[:8], order.Customer.Names, order.Customer.Email, order.Total)
 
 	for _, item := range order.Items {
-		body += fmt.Sprintf("- %dx %s ($%.2f each)\n",
+		body += fmt.Sprintf("- %dx %s (%s each)\n",
 			item.Quantity, item.Product.Name, item.UnitPrice)
 	}
 
@@ -1,18 +1,50 @@
 package orders
 
 import (
+	"ecommerce-service/engine/addresses"
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/engine/inventory"
 	"ecommerce-service/engine/notifications"
+	"ecommerce-service/engine/promotions"
+	"ecommerce-service/engine/shipping"
+	"ecommerce-service/engine/tax"
 	"ecommerce-service/graph/model"
 	"ecommerce-service/models"
 	"ecommerce-service/utils"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// InvalidTransitionError is returned when an order is moved to a status
+// that isn't reachable from its current one.
+type InvalidTransitionError struct {
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot change order status from %s to %s", e.From, e.To)
+}
+
+// OrderHook runs inside the order transaction after the order and its items
+// have been written. Returning an error rolls the whole order back.
+type OrderHook func(tx *gorm.DB, order *models.Order) error
+
 func CreateOrder(input model.OrderInput, userID string) (*model.Order, error) {
+	return CreateOrderWithHook(input, userID, nil)
+}
+
+// CreateOrderWithHook behaves like CreateOrder but calls beforeCommit before
+// the transaction is committed, so callers can make their own writes atomic
+// with the order.
+func CreateOrderWithHook(input model.OrderInput, userID string, beforeCommit OrderHook) (*model.Order, error) {
 	// Start transaction
 	tx := utils.DB.Begin()
 	defer func() {
@@ -26,10 +58,33 @@ func CreateOrder(input model.OrderInput, userID string) (*model.Order, error) {
 		return nil, err
 	}
 
-	// Create order
+	// Prices are converted into the currency the customer pays in, and the
+	// rate is stored on each item so later rate changes don't affect it
+	var customer models.User
+	if err := tx.First(&customer, "id = ?", userUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	orderCurrency, err := currencies.DisplayCurrency(input.Currency, customer.Country)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	address, err := addresses.ForOrder(tx, userID, input.ShippingAddressID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Create order. The address is copied so later edits don't change
+	// where this order was sent.
 	order := models.Order{
-		CustomerID: userUUID,
-		Status:     models.OrderStatusPending,
+		CustomerID:      userUUID,
+		Status:          models.OrderStatusPending,
+		Total:           model.NewMoney(0, orderCurrency),
+		ShippingAddress: address.PostalAddress,
 	}
 
 	if err := tx.Create(&order).Error; err != nil {
@@ -37,66 +92,253 @@ func CreateOrder(input model.OrderInput, userID string) (*model.Order, error) {
 		return nil, err
 	}
 
-	// Process order items
-	var total float64
-	for _, itemInput := range input.Items {
+	// Record the initial status
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:  order.ID,
+		ToStatus: order.Status,
+		ActorID:  &userUUID,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	productUUIDs := make([]uuid.UUID, len(input.Items))
+	variantIDs := make([]*string, len(input.Items))
+	for i, itemInput := range input.Items {
 		productUUID, err := uuid.FromString(itemInput.ProductID)
 		if err != nil {
 			tx.Rollback()
 			return nil, err
 		}
+		productUUIDs[i] = productUUID
+		variantIDs[i] = itemInput.VariantID
+	}
 
-		// Get product
-		var product models.Product
-		if err := tx.First(&product, "id = ?", productUUID).Error; err != nil {
+	// Lock every product up front, in a fixed order, so concurrent checkouts
+	// of overlapping carts queue up instead of deadlocking
+	products, err := inventory.LockProducts(tx, productUUIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, product := range products {
+		if product.DeletedAt != nil {
 			tx.Rollback()
-			return nil, err
+			return nil, inventory.ErrProductNotFound
 		}
+	}
 
-		// Check stock
-		if int(product.Stock) < int(itemInput.Quantity) {
+	// Products with variants are stocked per variant
+	variants, err := inventory.ResolveVariants(tx, productUUIDs, variantIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Total quantity requested per product or variant, so one listed twice
+	// is checked against its stock once
+	requested := make(map[uuid.UUID]int)
+	for i, itemInput := range input.Items {
+		stockID := productUUIDs[i]
+		if variants[i] != nil {
+			stockID = variants[i].ID
+		}
+		requested[stockID] += int(itemInput.Quantity)
+	}
+
+	// Check stock
+	for i := range input.Items {
+		product := products[productUUIDs[i]]
+		stockID, stock := product.ID, product.Stock
+		if variants[i] != nil {
+			stockID, stock = variants[i].ID, variants[i].Stock
+		}
+		if stock < requested[stockID] {
 			tx.Rollback()
 			return nil, errors.New("insufficient stock for product: " + product.Name)
 		}
+	}
 
-		// Create order item
-		orderItem := models.OrderItem{
-			OrderID:   order.ID,
-			ProductID: productUUID,
-			Quantity:  int(itemInput.Quantity),
-			UnitPrice: product.Price,
-			SubTotal:  product.Price * float64(itemInput.Quantity),
+	// Process order items
+	subtotal := model.NewMoney(0, orderCurrency)
+	orderItems := make([]models.OrderItem, 0, len(input.Items))
+	for i, itemInput := range input.Items {
+		product := products[productUUIDs[i]]
+		basePrice := product.Price
+		var variantID *uuid.UUID
+		if variants[i] != nil {
+			basePrice = variants[i].UnitPrice(product)
+			variantID = &variants[i].ID
 		}
 
-		if err := tx.Create(&orderItem).Error; err != nil {
+		unitPrice, rate, err := currencies.Convert(tx, basePrice, orderCurrency)
+		if err != nil {
 			tx.Rollback()
 			return nil, err
 		}
 
+		// Items are written once tax has been worked out below
+		orderItem := models.OrderItem{
+			OrderID:       order.ID,
+			ProductID:     product.ID,
+			VariantID:     variantID,
+			Quantity:      int(itemInput.Quantity),
+			UnitPrice:     unitPrice,
+			SubTotal:      unitPrice.Mul(int64(itemInput.Quantity)),
+			BaseUnitPrice: basePrice,
+			ExchangeRate:  currencies.FormatRate(rate),
+		}
+
 		// Update product stock
-		product.Stock -= int(itemInput.Quantity)
-		if err := tx.Save(&product).Error; err != nil {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID:   product.ID,
+			VariantID:   variantID,
+			Delta:       -orderItem.Quantity,
+			Reason:      models.InventoryReasonSale,
+			ReferenceID: &order.ID,
+		}); err != nil {
 			tx.Rollback()
+			if errors.Is(err, inventory.ErrInsufficientStock) {
+				return nil, errors.New("insufficient stock for product: " + product.Name)
+			}
 			return nil, err
 		}
 
-		total += orderItem.SubTotal
+		subtotal, err = subtotal.Add(orderItem.SubTotal)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		orderItems = append(orderItems, orderItem)
+	}
+
+	order.Subtotal = subtotal
+	order.DiscountTotal = model.NewMoney(0, orderCurrency)
+
+	// Apply coupon
+	var discountShares []model.Money
+	if input.CouponCode != nil && strings.TrimSpace(*input.CouponCode) != "" {
+		discount, shares, err := promotions.Apply(tx, *input.CouponCode, &order, orderItems)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		order.DiscountTotal = discount.Amount
+		discountShares = shares
+	}
+
+	// Tax each item on what the customer pays for it after discount, at the
+	// rate for the country it is shipped to
+	calculator, err := tax.NewCalculator(tx, address.Country, productUUIDs)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
-	// Update order total
-	order.Total = total
+	order.TaxAmount = model.NewMoney(0, orderCurrency)
+	exclusiveTax := model.NewMoney(0, orderCurrency)
+	for i := range orderItems {
+		orderItem := &orderItems[i]
+
+		orderItem.DiscountAmount = model.NewMoney(0, orderCurrency)
+		if discountShares != nil {
+			orderItem.DiscountAmount = discountShares[i]
+		}
+
+		taxable, err := orderItem.SubTotal.Sub(orderItem.DiscountAmount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		taxRate, err := calculator.RateFor(orderItem.ProductID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		orderItem.TaxAmount, err = tax.Calculate(taxRate, taxable)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		orderItem.TaxRate = "0"
+		if taxRate != nil {
+			orderItem.TaxRate = taxRate.Rate
+			orderItem.TaxInclusive = taxRate.PricesIncludeTax
+		}
+
+		if err := tx.Create(orderItem).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		order.TaxAmount, err = order.TaxAmount.Add(orderItem.TaxAmount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if !orderItem.TaxInclusive {
+			exclusiveTax, err = exclusiveTax.Add(orderItem.TaxAmount)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+	}
+
+	// Shipping is charged on what the goods cost after discount
+	goodsValue, err := subtotal.Sub(order.DiscountTotal)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	parcel := shipping.Parcel{Value: goodsValue}
+	for _, orderItem := range orderItems {
+		parcel.Weight += products[orderItem.ProductID].Weight * orderItem.Quantity
+	}
+
+	method, shippingCost, err := shipping.ForOrder(tx, input.ShippingMethodID, address.Country, parcel)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	order.ShippingMethodID = &method.ID
+	order.ShippingMethodName = method.Name
+	order.ShippingCost = shippingCost
+
+	// Update order total. Tax inside inclusive prices is already part of
+	// the subtotal.
+	order.Total, err = goodsValue.Add(exclusiveTax)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	order.Total, err = order.Total.Add(shippingCost)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 	if err := tx.Save(&order).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
+	if beforeCommit != nil {
+		if err := beforeCommit(tx, &order); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
 
 	// Load full order with relations
-	if err := utils.DB.Preload("Customer").Preload("Items.Product").First(&order, order.ID).Error; err != nil {
+	if err := preloadOrder(utils.DB).First(&order, order.ID).Error; err != nil {
 		return nil, err
 	}
 
@@ -109,19 +351,19 @@ func CreateOrder(input model.OrderInput, userID string) (*model.Order, error) {
 	return order.ToGraphQL(), nil
 }
 
-func GetOrder(id string, userID string) (*model.Order, error) {
+func GetOrder(id string, userID string, anyOrder bool) (*model.Order, error) {
 	orderUUID, err := uuid.FromString(id)
 	if err != nil {
 		return nil, err
 	}
 
 	var order models.Order
-	if err := utils.DB.Preload("Customer").Preload("Items.Product").First(&order, "id = ?", orderUUID).Error; err != nil {
+	if err := preloadOrder(utils.DB).First(&order, "id = ?", orderUUID).Error; err != nil {
 		return nil, err
 	}
 
 	// Verify user owns this order
-	if order.CustomerID.String() != userID && order.Customer.Role != models.RoleAdmin {
+	if order.CustomerID.String() != userID && !anyOrder {
 		return nil, errors.New("unauthorized access to order")
 	}
 
@@ -135,7 +377,7 @@ func GetUserOrders(userID string) ([]*model.Order, error) {
 	}
 
 	var orders []models.Order
-	if err := utils.DB.Preload("Customer").Preload("Items.Product").
+	if err := preloadOrder(utils.DB).
 		Where("customer_id = ?", userUUID).
 		Find(&orders).Error; err != nil {
 		return nil, err
@@ -149,12 +391,19 @@ func GetUserOrders(userID string) ([]*model.Order, error) {
 	return result, nil
 }
 
-func UpdateOrderStatus(id string, status model.OrderStatus) (*model.Order, error) {
+// UpdateOrderStatus moves an order to a new status, enforcing the allowed
+// transitions and recording the change in the order's status history.
+func UpdateOrderStatus(id string, status model.OrderStatus, actorID string, note *string) (*model.Order, error) {
 	orderUUID, err := uuid.FromString(id)
 	if err != nil {
 		return nil, err
 	}
 
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
 	tx := utils.DB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -163,15 +412,17 @@ func UpdateOrderStatus(id string, status model.OrderStatus) (*model.Order, error
 	}()
 
 	var order models.Order
-	if err := tx.Preload("Customer").Preload("Items.Product").First(&order, "id = ?", orderUUID).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", orderUUID).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	// Update status
-	order.Status = models.OrderStatus(status)
+	historyNote := ""
+	if note != nil {
+		historyNote = *note
+	}
 
-	if err := tx.Save(&order).Error; err != nil {
+	if err := Transition(tx, &order, models.OrderStatus(status), &actorUUID, historyNote); err != nil {
 		tx.Rollback()
 		return nil, err
 	}
@@ -181,24 +432,147 @@ func UpdateOrderStatus(id string, status model.OrderStatus) (*model.Order, error
 		return nil, err
 	}
 
+	if err := preloadOrder(utils.DB).First(&order, "id = ?", orderUUID).Error; err != nil {
+		return nil, err
+	}
+
+	notifyStatusChange(&order)
+
+	return order.ToGraphQL(), nil
+}
+
+// Transition moves an order to next and records the change, restocking it
+// and releasing its coupon if it is being cancelled. The caller must hold a
+// row lock on the order (SELECT ... FOR UPDATE in tx). actorID is nil for
+// changes made by the system, such as a payment webhook.
+func Transition(tx *gorm.DB, order *models.Order, next models.OrderStatus, actorID *uuid.UUID, note string) error {
+	previous := order.Status
+	if !previous.CanTransitionTo(next) {
+		return &InvalidTransitionError{From: previous, To: next}
+	}
+
+	// Update status
+	order.Status = next
+
+	if err := tx.Model(order).Update("status", order.Status).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Create(&models.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: &previous,
+		ToStatus:   next,
+		ActorID:    actorID,
+		Note:       note,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Give cancelled units back to stock and the coupon use back to the
+	// customer
+	if next == models.OrderStatusCancelled {
+		if err := restockOrder(tx, order); err != nil {
+			return err
+		}
+		if err := promotions.Release(tx, order.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotifyStatusChange tells the customer and admins about a status change
+// made through Transition, once its transaction has committed
+func NotifyStatusChange(orderID uuid.UUID) error {
+	var order models.Order
+	if err := preloadOrder(utils.DB).First(&order, "id = ?", orderID).Error; err != nil {
+		return err
+	}
+
+	notifyStatusChange(&order)
+	return nil
+}
+
+func notifyStatusChange(order *models.Order) {
 	// Send notifications asynchronously
 	go func() {
+		log.Printf("Order #%s status has been updated to %s", order.ID.String()[:8], order.Status)
+
 		// Send SMS notification to customer
-		message := fmt.Sprintf(
-			"Your order #%s status has been updated to %s",
-			order.ID.String()[:8],
-			status,
-		)
-		fmt.Println(message)
-		if err := notifications.SendOrderConfirmationSMS(&order); err != nil {
+		if err := notifications.SendOrderConfirmationSMS(order); err != nil {
 			log.Printf("Failed to send SMS notification: %v", err)
 		}
 
 		// Send email notification
-		if err := notifications.SendOrderNotificationEmail(&order); err != nil {
+		if err := notifications.SendOrderNotificationEmail(order); err != nil {
 			log.Printf("Failed to send email notification: %v", err)
 		}
 	}()
+}
 
-	return order.ToGraphQL(), nil
+// restockOrder returns every item of a cancelled order to stock. The
+// restocked_at guard makes it safe to call more than once for the same order.
+func restockOrder(tx *gorm.DB, order *models.Order) error {
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND restocked_at IS NULL", order.ID).
+		Update("restocked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Already restocked
+		return nil
+	}
+
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Order("product_id").Find(&items).Error; err != nil {
+		return err
+	}
+
+	productUUIDs := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		productUUIDs[i] = item.ProductID
+	}
+	if _, err := inventory.LockProducts(tx, productUUIDs); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Delta:       item.Quantity,
+			Reason:      models.InventoryReasonCancellation,
+			ReferenceID: &order.ID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// preloadOrder loads the relations needed to render an order
+func preloadOrder(db *gorm.DB) *gorm.DB {
+	return db.Preload("Customer").
+		Preload("Items.Product").
+		Preload("Items.Variant.OptionValues.Option").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("StatusHistory.Actor").
+		Preload("Discounts").
+		Preload("Payments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("Payments.Refunds", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("Returns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Preload("Returns.Items.OrderItem.Product").
+		Preload("Returns.Items.OrderItem.Variant.OptionValues.Option").
+		Preload("Returns.PaymentRefund")
 }
@@ -0,0 +1,226 @@
+package orders
+
+import (
+	"ecommerce-service/engine/products"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// createProduct adds a product and receives its stock through the ledger,
+// so the ledger balances from the start
+func createProduct(t *testing.T, stock int) *models.Product {
+	t.Helper()
+
+	product := models.Product{
+		Name:  "Test Product",
+		Price: model.NewMoney(1000, model.DefaultCurrency()),
+		SKU:   "TEST-" + uuid.NewV4().String(),
+	}
+	if err := utils.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := utils.DB.Exec(`UPDATE products SET stock = ? WHERE id = ?`, stock, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Create(&models.InventoryMovement{
+		ProductID: product.ID,
+		Delta:     stock,
+		Reason:    models.InventoryReasonReceipt,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return &product
+}
+
+func TestCreateOrderConcurrentStock(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	const stock = 5
+	const buyers = 20
+
+	customer := utils.CreateTestCustomer(t)
+	product := createProduct(t, stock)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, buyers)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := CreateOrder(model.OrderInput{
+				Items: []*model.OrderItemInput{{ProductID: product.ID.String(), Quantity: 1}},
+			}, customer.ID.String())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	placed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !strings.Contains(err.Error(), "insufficient stock"):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if placed != stock {
+		t.Errorf("placed %d orders, want %d", placed, stock)
+	}
+
+	var final models.Product
+	if err := utils.DB.First(&final, "id = ?", product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if final.Stock < 0 {
+		t.Errorf("stock went negative: %d", final.Stock)
+	}
+	if final.Stock != stock-placed {
+		t.Errorf("stock is %d after %d orders, want %d", final.Stock, placed, stock-placed)
+	}
+
+	var ledger int
+	if err := utils.DB.Model(&models.InventoryMovement{}).
+		Select("COALESCE(SUM(delta), 0)").
+		Where("product_id = ?", product.ID).
+		Scan(&ledger).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ledger != final.Stock {
+		t.Errorf("ledger sums to %d, stock is %d", ledger, final.Stock)
+	}
+}
+
+func TestCreateOrderTaxesShippingCountry(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	customer := utils.CreateTestCustomer(t)
+	product := createProduct(t, 1)
+
+	var address models.Address
+	if err := utils.DB.First(&address, "user_id = ?", customer.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The customer lives somewhere else than the order is shipped to
+	if err := utils.DB.Model(customer).Update("country", "QQ").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Exec(`DELETE FROM tax_rates WHERE country IN (?, ?)`, "QQ", address.Country).Error; err != nil {
+		t.Fatal(err)
+	}
+	for country, rate := range map[string]string{"QQ": "50", address.Country: "10"} {
+		if err := utils.DB.Create(&models.TaxRate{Country: country, Name: "VAT", Rate: rate}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	order, err := CreateOrder(model.OrderInput{
+		Items: []*model.OrderItemInput{{ProductID: product.ID.String(), Quantity: 1}},
+	}, customer.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := model.NewMoney(100, model.DefaultCurrency()); order.TaxAmount != want {
+		t.Errorf("tax is %s, want %s at the shipping country's rate", order.TaxAmount, want)
+	}
+}
+
+func TestCategoryCouponCoversSubcategoriesAndIsReleasedOnCancel(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	customer := utils.CreateTestCustomer(t)
+	product := createProduct(t, 2)
+
+	parent := models.Category{Name: "Coupon Parent"}
+	if err := utils.DB.Create(&parent).Error; err != nil {
+		t.Fatal(err)
+	}
+	child := models.Category{Name: "Coupon Child", ParentID: &parent.ID, Level: 1}
+	if err := utils.DB.Create(&child).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Model(product).Association("Categories").Append(&child); err != nil {
+		t.Fatal(err)
+	}
+
+	// Scoped to the parent only, and usable once per customer
+	once := 1
+	code := "SUB" + strings.ToUpper(uuid.NewV4().String()[:8])
+	if err := utils.DB.Create(&models.Promotion{
+		Code:             code,
+		Type:             models.PromotionTypePercentage,
+		PercentOff:       10,
+		Scope:            models.PromotionScopeCategory,
+		Categories:       []models.Category{parent},
+		PerCustomerLimit: &once,
+		Active:           true,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	input := model.OrderInput{
+		Items:      []*model.OrderItemInput{{ProductID: product.ID.String(), Quantity: 1}},
+		CouponCode: &code,
+	}
+	order, err := CreateOrder(input, customer.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := model.NewMoney(100, model.DefaultCurrency()); order.DiscountTotal != want {
+		t.Errorf("discount is %s, want %s for a product in a subcategory", order.DiscountTotal, want)
+	}
+
+	if _, err := UpdateOrderStatus(order.ID, model.OrderStatusCancelled, customer.ID.String(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cancelled order's use is given back, so the coupon works again
+	if _, err := CreateOrder(input, customer.ID.String()); err != nil {
+		t.Errorf("coupon was not released on cancellation: %v", err)
+	}
+}
+
+func TestVariantWithoutPriceSellsAtProductPrice(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	customer := utils.CreateTestCustomer(t)
+	product := createProduct(t, 0)
+
+	if _, err := products.AddProductOption(product.ID.String(), model.ProductOptionInput{
+		Name:   "Size",
+		Values: []string{"S", "M"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	created, err := products.CreateProductVariant(product.ID.String(), model.ProductVariantInput{
+		Sku:     "TEST-" + uuid.NewV4().String(),
+		Stock:   2,
+		Options: []*model.SelectedOptionInput{{Name: "Size", Value: "M"}},
+	}, customer.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	variantID := created.Variants[0].ID
+
+	order, err := CreateOrder(model.OrderInput{
+		Items: []*model.OrderItemInput{{ProductID: product.ID.String(), VariantID: &variantID, Quantity: 1}},
+	}, customer.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := order.Items[0].UnitPrice; got != product.Price {
+		t.Errorf("variant sold at %s, want the product's %s", got, product.Price)
+	}
+}
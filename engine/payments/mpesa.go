@@ -0,0 +1,428 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"ecommerce-service/graph/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Daraja result codes
+const (
+	mpesaResultSuccess = 0
+	// Returned by the STK query while the customer hasn't answered yet
+	mpesaStillProcessing = "500.001.1001"
+)
+
+var (
+	ErrMpesaCurrency      = errors.New("M-Pesa payments must be in KES")
+	ErrMpesaAmount        = errors.New("M-Pesa can only charge whole shillings")
+	ErrMpesaPartialRefund = errors.New("M-Pesa reversals refund the whole payment; partial refunds are not supported")
+)
+
+type MpesaConfig struct {
+	BaseURL        string // https://sandbox.safaricom.co.ke or https://api.safaricom.co.ke
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	Passkey        string
+	// Daraja callbacks are unsigned, so the webhook URL carries a secret
+	// token that callbacks must echo back
+	CallbackURL   string
+	CallbackToken string
+	// Used for reversals (refunds)
+	Initiator          string
+	SecurityCredential string
+}
+
+func MpesaConfigFromEnv() MpesaConfig {
+	return MpesaConfig{
+		BaseURL:            os.Getenv("MPESA_BASE_URL"),
+		ConsumerKey:        os.Getenv("MPESA_CONSUMER_KEY"),
+		ConsumerSecret:     os.Getenv("MPESA_CONSUMER_SECRET"),
+		ShortCode:          os.Getenv("MPESA_SHORTCODE"),
+		Passkey:            os.Getenv("MPESA_PASSKEY"),
+		CallbackURL:        os.Getenv("MPESA_CALLBACK_URL"),
+		CallbackToken:      os.Getenv("MPESA_CALLBACK_TOKEN"),
+		Initiator:          os.Getenv("MPESA_INITIATOR"),
+		SecurityCredential: os.Getenv("MPESA_SECURITY_CREDENTIAL"),
+	}
+}
+
+// MpesaProvider collects payments with Safaricom Daraja STK push and
+// refunds them with transaction reversals
+type MpesaProvider struct {
+	config MpesaConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewMpesaProvider(config MpesaConfig) *MpesaProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://sandbox.safaricom.co.ke"
+	}
+	return &MpesaProvider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *MpesaProvider) Name() string {
+	return "mpesa"
+}
+
+func (p *MpesaProvider) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	amount, err := mpesaAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	phone, err := mpesaPhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, password := p.password()
+	body := map[string]interface{}{
+		"BusinessShortCode": p.config.ShortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            amount,
+		"PartyA":            phone,
+		"PartyB":            p.config.ShortCode,
+		"PhoneNumber":       phone,
+		"CallBackURL":       p.callbackURL(),
+		"AccountReference":  req.OrderID.String()[:8],
+		"TransactionDesc":   req.Description,
+	}
+
+	var response struct {
+		CheckoutRequestID   string
+		ResponseCode        string
+		ResponseDescription string
+		CustomerMessage     string
+	}
+	if err := p.post(ctx, "/mpesa/stkpush/v1/processrequest", body, &response); err != nil {
+		return nil, err
+	}
+	if response.ResponseCode != "0" {
+		return nil, fmt.Errorf("mpesa: %s", response.ResponseDescription)
+	}
+
+	return &InitiateResult{
+		ProviderRef:     response.CheckoutRequestID,
+		CustomerMessage: response.CustomerMessage,
+	}, nil
+}
+
+func (p *MpesaProvider) Confirm(ctx context.Context, providerRef string) (*Event, error) {
+	timestamp, password := p.password()
+	body := map[string]interface{}{
+		"BusinessShortCode": p.config.ShortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": providerRef,
+	}
+
+	var response struct {
+		ResultCode string
+		ResultDesc string
+	}
+	err := p.post(ctx, "/mpesa/stkpushquery/v1/query", body, &response)
+	var apiErr *mpesaError
+	if errors.As(err, &apiErr) && apiErr.Code == mpesaStillProcessing {
+		return &Event{Type: EventPaymentPending, ProviderRef: providerRef}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The query doesn't return the receipt; that arrives with the callback
+	if response.ResultCode == strconv.Itoa(mpesaResultSuccess) {
+		return &Event{Type: EventPaymentCaptured, ProviderRef: providerRef}, nil
+	}
+	return &Event{Type: EventPaymentFailed, ProviderRef: providerRef, FailureReason: response.ResultDesc}, nil
+}
+
+func (p *MpesaProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	// A TransactionReversal always reverses the whole transaction
+	if req.Amount != req.PaymentAmount {
+		return nil, ErrMpesaPartialRefund
+	}
+	amount, err := mpesaAmount(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	remarks := truncate(req.Reason, 100)
+	if remarks == "" {
+		remarks = "Refund"
+	}
+
+	body := map[string]interface{}{
+		"Initiator":              p.config.Initiator,
+		"SecurityCredential":     p.config.SecurityCredential,
+		"CommandID":              "TransactionReversal",
+		"TransactionID":          req.Receipt,
+		"Amount":                 amount,
+		"ReceiverParty":          p.config.ShortCode,
+		"RecieverIdentifierType": "11",
+		"ResultURL":              p.callbackURL(),
+		"QueueTimeOutURL":        p.callbackURL(),
+		"Remarks":                remarks,
+		"Occasion":               req.RefundID.String(),
+	}
+
+	var response struct {
+		ConversationID      string
+		ResponseCode        string
+		ResponseDescription string
+	}
+	if err := p.post(ctx, "/mpesa/reversal/v1/request", body, &response); err != nil {
+		return nil, err
+	}
+	if response.ResponseCode != "0" {
+		return nil, fmt.Errorf("mpesa: %s", response.ResponseDescription)
+	}
+
+	// The outcome arrives later on the result URL
+	return &RefundResult{ProviderRef: response.ConversationID}, nil
+}
+
+func (p *MpesaProvider) ParseWebhook(r *http.Request) (*Event, error) {
+	token := r.URL.Query().Get("token")
+	if p.config.CallbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.config.CallbackToken)) != 1 {
+		return nil, ErrInvalidWebhook
+	}
+
+	var payload struct {
+		// STK push callback
+		Body *struct {
+			StkCallback struct {
+				CheckoutRequestID string
+				ResultCode        int
+				ResultDesc        string
+				CallbackMetadata  struct {
+					Item []struct {
+						Name  string
+						Value interface{}
+					}
+				}
+			} `json:"stkCallback"`
+		}
+		// Reversal result
+		Result *struct {
+			ResultCode     int
+			ResultDesc     string
+			ConversationID string
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	switch {
+	case payload.Body != nil:
+		callback := payload.Body.StkCallback
+		if callback.ResultCode != mpesaResultSuccess {
+			return &Event{
+				Type:          EventPaymentFailed,
+				ProviderRef:   callback.CheckoutRequestID,
+				FailureReason: callback.ResultDesc,
+			}, nil
+		}
+
+		event := &Event{Type: EventPaymentCaptured, ProviderRef: callback.CheckoutRequestID}
+		for _, item := range callback.CallbackMetadata.Item {
+			switch item.Name {
+			case "MpesaReceiptNumber":
+				event.Receipt = fmt.Sprint(item.Value)
+			case "Amount":
+				if amount, ok := item.Value.(float64); ok {
+					paid := model.NewMoney(int64(math.Round(amount*100)), "KES")
+					event.Amount = &paid
+				}
+			}
+		}
+		return event, nil
+	case payload.Result != nil:
+		if payload.Result.ResultCode != mpesaResultSuccess {
+			return &Event{
+				Type:          EventRefundFailed,
+				ProviderRef:   payload.Result.ConversationID,
+				FailureReason: payload.Result.ResultDesc,
+			}, nil
+		}
+		return &Event{Type: EventRefundSucceeded, ProviderRef: payload.Result.ConversationID}, nil
+	}
+
+	return &Event{Type: EventUnhandled}, nil
+}
+
+// password builds the STK password, which is derived from the time of the
+// request
+func (p *MpesaProvider) password() (string, string) {
+	timestamp := time.Now().In(nairobi).Format("20060102150405")
+	password := base64.StdEncoding.EncodeToString([]byte(p.config.ShortCode + p.config.Passkey + timestamp))
+	return timestamp, password
+}
+
+func (p *MpesaProvider) callbackURL() string {
+	separator := "?"
+	if strings.Contains(p.config.CallbackURL, "?") {
+		separator = "&"
+	}
+	return p.config.CallbackURL + separator + "token=" + p.config.CallbackToken
+}
+
+// accessToken returns a cached OAuth token, fetching a new one shortly
+// before the old one expires
+func (p *MpesaProvider) accessToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		p.config.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.config.ConsumerKey, p.config.ConsumerSecret)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mpesa: token request failed with status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	seconds, err := strconv.Atoi(token.ExpiresIn)
+	if err != nil {
+		seconds = 3599
+	}
+	p.token = token.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(seconds-60) * time.Second)
+
+	return p.token, nil
+}
+
+type mpesaError struct {
+	Code    string `json:"errorCode"`
+	Message string `json:"errorMessage"`
+}
+
+func (e *mpesaError) Error() string {
+	return fmt.Sprintf("mpesa: %s (%s)", e.Message, e.Code)
+}
+
+func (p *MpesaProvider) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr mpesaError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Code != "" {
+			return &apiErr
+		}
+		return fmt.Errorf("mpesa: %s returned status %d", path, resp.StatusCode)
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+var nairobi = time.FixedZone("EAT", 3*60*60)
+
+// mpesaPhoneNumber converts 07XXXXXXXX, 7XXXXXXXX and +2547XXXXXXXX to the
+// 2547XXXXXXXX form Daraja expects
+func mpesaPhoneNumber(phone string) (string, error) {
+	phone = strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(phone), " ", ""), "+")
+	switch {
+	case strings.HasPrefix(phone, "0") && len(phone) == 10:
+		phone = "254" + phone[1:]
+	case len(phone) == 9:
+		phone = "254" + phone
+	}
+
+	if len(phone) != 12 || !strings.HasPrefix(phone, "254") {
+		return "", ErrInvalidPhoneNumber
+	}
+	if _, err := strconv.ParseUint(phone, 10, 64); err != nil {
+		return "", ErrInvalidPhoneNumber
+	}
+	return phone, nil
+}
+
+// mpesaAmount converts to whole shillings. Amounts with cents are refused
+// rather than rounded, so the customer is never charged more or less than
+// the payment records.
+func mpesaAmount(amount model.Money) (int64, error) {
+	if amount.Currency != "KES" {
+		return 0, ErrMpesaCurrency
+	}
+	if amount.Amount%100 != 0 {
+		return 0, ErrMpesaAmount
+	}
+	return amount.Amount / 100, nil
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return value[:length]
+}
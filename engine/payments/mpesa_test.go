@@ -0,0 +1,216 @@
+package payments
+
+import (
+	"context"
+	"ecommerce-service/graph/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// mpesaServer fakes Daraja: it issues OAuth tokens and passes every other
+// request, with its decoded JSON body, to handler
+func mpesaServer(t *testing.T, handler func(w http.ResponseWriter, path string, body map[string]interface{})) (*MpesaProvider, *int) {
+	t.Helper()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/v1/generate" {
+			if key, secret, ok := r.BasicAuth(); !ok || key != "key" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "token", "expires_in": "3599"}`)
+			return
+		}
+
+		calls++
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		handler(w, r.URL.Path, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewMpesaProvider(MpesaConfig{
+		BaseURL:            server.URL,
+		ConsumerKey:        "key",
+		ConsumerSecret:     "secret",
+		ShortCode:          "174379",
+		Passkey:            "passkey",
+		CallbackURL:        "https://shop.example.com/webhooks/mpesa",
+		CallbackToken:      "callback-token",
+		Initiator:          "api-user",
+		SecurityCredential: "credential",
+	}), &calls
+}
+
+func TestMpesaInitiate(t *testing.T) {
+	p, _ := mpesaServer(t, func(w http.ResponseWriter, path string, body map[string]interface{}) {
+		if path != "/mpesa/stkpush/v1/processrequest" {
+			t.Errorf("unexpected request to %s", path)
+		}
+		if body["Amount"] != float64(1500) {
+			t.Errorf("Amount = %v, want whole shillings", body["Amount"])
+		}
+		if body["PhoneNumber"] != "254712345678" || body["PartyA"] != "254712345678" {
+			t.Errorf("phone = %v / %v", body["PhoneNumber"], body["PartyA"])
+		}
+		if callback, _ := body["CallBackURL"].(string); !strings.HasSuffix(callback, "?token=callback-token") {
+			t.Errorf("CallBackURL = %q, want the callback token", callback)
+		}
+		fmt.Fprint(w, `{"CheckoutRequestID": "ws_CO_123", "ResponseCode": "0", "CustomerMessage": "Check your phone"}`)
+	})
+
+	result, err := p.Initiate(context.Background(), InitiateRequest{
+		PaymentID:   uuid.NewV4(),
+		OrderID:     uuid.NewV4(),
+		Amount:      model.NewMoney(150000, "KES"),
+		PhoneNumber: "0712 345 678",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ProviderRef != "ws_CO_123" || result.CustomerMessage != "Check your phone" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestMpesaInitiateRejectsUnchargeableAmounts(t *testing.T) {
+	p, calls := mpesaServer(t, func(w http.ResponseWriter, path string, body map[string]interface{}) {
+		t.Errorf("unexpected request to %s", path)
+	})
+
+	tests := []struct {
+		amount model.Money
+		phone  string
+		want   error
+	}{
+		{model.NewMoney(150050, "KES"), "0712345678", ErrMpesaAmount},
+		{model.NewMoney(1500, "USD"), "0712345678", ErrMpesaCurrency},
+		{model.NewMoney(150000, "KES"), "12345", ErrInvalidPhoneNumber},
+	}
+	for _, test := range tests {
+		_, err := p.Initiate(context.Background(), InitiateRequest{
+			PaymentID:   uuid.NewV4(),
+			OrderID:     uuid.NewV4(),
+			Amount:      test.amount,
+			PhoneNumber: test.phone,
+		})
+		if !errors.Is(err, test.want) {
+			t.Errorf("Initiate(%s, %s) returned %v, want %v", test.amount, test.phone, err, test.want)
+		}
+	}
+	if *calls != 0 {
+		t.Errorf("made %d requests to Daraja", *calls)
+	}
+}
+
+func TestMpesaRefund(t *testing.T) {
+	refundID := uuid.NewV4()
+	p, calls := mpesaServer(t, func(w http.ResponseWriter, path string, body map[string]interface{}) {
+		if path != "/mpesa/reversal/v1/request" {
+			t.Errorf("unexpected request to %s", path)
+		}
+		if body["CommandID"] != "TransactionReversal" || body["TransactionID"] != "QKJ1ABC2DE" {
+			t.Errorf("got %v", body)
+		}
+		if body["Amount"] != float64(1500) || body["Occasion"] != refundID.String() {
+			t.Errorf("Amount = %v, Occasion = %v", body["Amount"], body["Occasion"])
+		}
+		fmt.Fprint(w, `{"ConversationID": "AG_20240101_123", "ResponseCode": "0"}`)
+	})
+
+	result, err := p.Refund(context.Background(), RefundRequest{
+		RefundID:      refundID,
+		ProviderRef:   "ws_CO_123",
+		Receipt:       "QKJ1ABC2DE",
+		Amount:        model.NewMoney(150000, "KES"),
+		PaymentAmount: model.NewMoney(150000, "KES"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reversals complete later, on the result URL
+	if result.ProviderRef != "AG_20240101_123" || result.Succeeded {
+		t.Errorf("got %+v", result)
+	}
+
+	_, err = p.Refund(context.Background(), RefundRequest{
+		RefundID:      uuid.NewV4(),
+		Receipt:       "QKJ1ABC2DE",
+		Amount:        model.NewMoney(50000, "KES"),
+		PaymentAmount: model.NewMoney(150000, "KES"),
+	})
+	if !errors.Is(err, ErrMpesaPartialRefund) {
+		t.Errorf("partial refund returned %v, want ErrMpesaPartialRefund", err)
+	}
+	if *calls != 1 {
+		t.Errorf("made %d reversal requests, want 1", *calls)
+	}
+}
+
+func mpesaCallback(token string, body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/webhooks/mpesa?token="+token, strings.NewReader(body))
+}
+
+func TestMpesaParseWebhook(t *testing.T) {
+	p := NewMpesaProvider(MpesaConfig{CallbackToken: "callback-token"})
+
+	paid := `{"Body": {"stkCallback": {"CheckoutRequestID": "ws_CO_123", "ResultCode": 0, "ResultDesc": "Processed",
+		"CallbackMetadata": {"Item": [{"Name": "Amount", "Value": 1500}, {"Name": "MpesaReceiptNumber", "Value": "QKJ1ABC2DE"}]}}}}`
+	event, err := p.ParseWebhook(mpesaCallback("callback-token", paid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := model.NewMoney(150000, "KES")
+	if event.Type != EventPaymentCaptured || event.ProviderRef != "ws_CO_123" || event.Receipt != "QKJ1ABC2DE" ||
+		event.Amount == nil || *event.Amount != want {
+		t.Errorf("got %+v", event)
+	}
+
+	cancelled := `{"Body": {"stkCallback": {"CheckoutRequestID": "ws_CO_123", "ResultCode": 1032, "ResultDesc": "Request cancelled by user"}}}`
+	event, err = p.ParseWebhook(mpesaCallback("callback-token", cancelled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventPaymentFailed || event.FailureReason != "Request cancelled by user" {
+		t.Errorf("got %+v", event)
+	}
+
+	reversed := `{"Result": {"ResultCode": 0, "ResultDesc": "Reversed", "ConversationID": "AG_20240101_123"}}`
+	event, err = p.ParseWebhook(mpesaCallback("callback-token", reversed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventRefundSucceeded || event.ProviderRef != "AG_20240101_123" {
+		t.Errorf("got %+v", event)
+	}
+}
+
+func TestMpesaParseWebhookRejectsBadToken(t *testing.T) {
+	body := `{"Body": {"stkCallback": {"CheckoutRequestID": "ws_CO_123", "ResultCode": 0}}}`
+
+	p := NewMpesaProvider(MpesaConfig{CallbackToken: "callback-token"})
+	for _, token := range []string{"", "wrong-token"} {
+		if _, err := p.ParseWebhook(mpesaCallback(token, body)); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("token %q: got %v, want ErrInvalidWebhook", token, err)
+		}
+	}
+
+	// Without a configured token every callback is refused
+	unconfigured := NewMpesaProvider(MpesaConfig{})
+	if _, err := unconfigured.ParseWebhook(mpesaCallback("", body)); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("unconfigured: got %v, want ErrInvalidWebhook", err)
+	}
+}
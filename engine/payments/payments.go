@@ -0,0 +1,688 @@
+package payments
+
+import (
+	"context"
+	"ecommerce-service/engine/orders"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownProvider      = errors.New("unknown payment provider")
+	ErrInvalidWebhook       = errors.New("webhook could not be verified")
+	ErrInvalidPhoneNumber   = errors.New("phone number is not a valid M-Pesa number")
+	ErrPaymentNotFound      = errors.New("payment not found")
+	ErrRefundNotFound       = errors.New("refund not found")
+	ErrOrderNotPayable      = errors.New("only pending orders can be paid")
+	ErrOrderAlreadyPaid     = errors.New("order has already been paid")
+	ErrPaymentInProgress    = errors.New("a payment for this order is still pending; confirm it before trying again")
+	ErrPaymentNotRefundable = errors.New("payment has not been captured or is fully refunded")
+	ErrInvalidRefundAmount  = errors.New("refund amount must be positive and no more than the amount left to refund")
+)
+
+// A payment that was recorded but never got a provider reference is given up
+// on after this long; by then the call to the provider has timed out
+const staleInitiateAfter = 2 * time.Minute
+
+// InitiatePayment starts paying for a pending order with the named
+// provider. The payment is recorded before the provider is called so that
+// a webhook arriving quickly always finds it. An earlier attempt the
+// customer abandoned is called off first where the provider allows it.
+func InitiatePayment(ctx context.Context, orderID string, userID string, providerName string, phoneNumber *string) (*model.PaymentSession, error) {
+	p, err := provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	orderUUID, err := uuid.FromString(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, payment, err := recordPayment(orderUUID, userID, p)
+	if errors.Is(err, ErrPaymentInProgress) {
+		if err := supersedePendingPayments(ctx, orderUUID); err != nil {
+			return nil, err
+		}
+		order, payment, err = recordPayment(orderUUID, userID, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.DB.First(&order.Customer, "id = ?", order.CustomerID).Error; err != nil {
+		return nil, err
+	}
+
+	phone := order.Customer.PhoneNumber
+	if phoneNumber != nil && *phoneNumber != "" {
+		phone = *phoneNumber
+	}
+
+	result, err := p.Initiate(ctx, InitiateRequest{
+		PaymentID:   payment.ID,
+		OrderID:     order.ID,
+		Amount:      payment.Amount,
+		PhoneNumber: phone,
+		Description: fmt.Sprintf("Order #%s", order.ID.String()[:8]),
+	})
+	if err != nil {
+		if updateErr := utils.DB.Model(payment).Updates(map[string]interface{}{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": err.Error(),
+		}).Error; updateErr != nil {
+			log.Printf("Failed to record failed payment %s: %v", payment.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	if err := utils.DB.Model(payment).Update("provider_ref", result.ProviderRef).Error; err != nil {
+		return nil, err
+	}
+
+	loaded, err := loadPayment(payment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.PaymentSession{Payment: loaded}
+	if result.ClientSecret != "" {
+		session.ClientSecret = &result.ClientSecret
+	}
+	if result.CustomerMessage != "" {
+		session.CustomerMessage = &result.CustomerMessage
+	}
+	return session, nil
+}
+
+// recordPayment checks that the customer can pay for the order and records
+// a PENDING payment for it. The order stays locked until the payment is
+// recorded, so two attempts to pay it at once can't both get through.
+func recordPayment(orderUUID uuid.UUID, userID string, p PaymentProvider) (*models.Order, *models.Payment, error) {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", orderUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if order.CustomerID.String() != userID {
+		tx.Rollback()
+		return nil, nil, errors.New("unauthorized access to order")
+	}
+	if order.Status != models.OrderStatusPending {
+		tx.Rollback()
+		return nil, nil, ErrOrderNotPayable
+	}
+
+	var statuses []models.PaymentStatus
+	if err := tx.Model(&models.Payment{}).
+		Where("order_id = ? AND status IN ?", order.ID, []models.PaymentStatus{
+			models.PaymentStatusPending,
+			models.PaymentStatusCaptured,
+			models.PaymentStatusPartiallyRefunded,
+			models.PaymentStatusRefunded,
+		}).
+		Pluck("status", &statuses).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	for _, status := range statuses {
+		if status.IsCaptured() {
+			tx.Rollback()
+			return nil, nil, ErrOrderAlreadyPaid
+		}
+	}
+	if len(statuses) > 0 {
+		tx.Rollback()
+		return nil, nil, ErrPaymentInProgress
+	}
+
+	payment := models.Payment{
+		OrderID:        order.ID,
+		Provider:       p.Name(),
+		Status:         models.PaymentStatusPending,
+		Amount:         order.Total,
+		RefundedAmount: model.NewMoney(0, order.Total.Currency),
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, err
+	}
+	return &order, &payment, nil
+}
+
+// supersedePendingPayments clears the order's pending payments out of the
+// way of a new attempt. One that never reached the provider is failed once
+// it is stale. One that did is checked with the provider, in case it has
+// settled, and otherwise cancelled if the provider can cancel it. Anything
+// else is left pending, and the new attempt is refused.
+func supersedePendingPayments(ctx context.Context, orderUUID uuid.UUID) error {
+	var pending []models.Payment
+	if err := utils.DB.Where("order_id = ? AND status = ?", orderUUID, models.PaymentStatusPending).
+		Find(&pending).Error; err != nil {
+		return err
+	}
+
+	for _, payment := range pending {
+		if payment.ProviderRef == nil {
+			if time.Since(payment.CreatedAt) < staleInitiateAfter {
+				continue
+			}
+			if err := supersedePayment(utils.DB.Where("provider_ref IS NULL"), payment.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		p, err := provider(payment.Provider)
+		if err != nil {
+			return err
+		}
+
+		event, err := p.Confirm(ctx, *payment.ProviderRef)
+		if err != nil {
+			return err
+		}
+		if event.Type != EventPaymentPending {
+			if err := applyEvent(payment.Provider, event); err != nil {
+				return err
+			}
+			continue
+		}
+
+		canceller, ok := p.(PaymentCanceller)
+		if !ok {
+			continue
+		}
+		if err := canceller.Cancel(ctx, *payment.ProviderRef); err != nil {
+			// e.g. the customer completed it in the meantime; its webhook
+			// will settle it
+			log.Printf("Failed to cancel payment %s: %v", payment.ID, err)
+			continue
+		}
+		if err := supersedePayment(utils.DB, payment.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// supersedePayment fails a payment that is still pending in favour of a new
+// attempt. query can narrow down the conditions it must still meet.
+func supersedePayment(query *gorm.DB, paymentID uuid.UUID) error {
+	return query.Model(&models.Payment{}).
+		Where("id = ? AND status = ?", paymentID, models.PaymentStatusPending).
+		Updates(map[string]interface{}{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": "superseded by a new payment attempt",
+		}).Error
+}
+
+// ConfirmPayment asks the provider for the latest state of a payment and
+// applies it, for when a webhook is late or lost. Only the order's customer
+// can confirm a payment, unless anyPayment is set for staff who can read
+// every order.
+func ConfirmPayment(ctx context.Context, paymentID string, userID string, anyPayment bool) (*model.Payment, error) {
+	paymentUUID, err := uuid.FromString(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payment models.Payment
+	if err := utils.DB.First(&payment, "id = ?", paymentUUID).Error; err != nil {
+		return nil, ErrPaymentNotFound
+	}
+
+	if err := authorizePayment(&payment, userID, anyPayment); err != nil {
+		return nil, err
+	}
+
+	if payment.Status == models.PaymentStatusPending && payment.ProviderRef != nil {
+		p, err := provider(payment.Provider)
+		if err != nil {
+			return nil, err
+		}
+
+		event, err := p.Confirm(ctx, *payment.ProviderRef)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyEvent(payment.Provider, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return loadPayment(payment.ID)
+}
+
+// HandleWebhook verifies and applies a callback from a provider. Events
+// for payments this service didn't create are ignored.
+func HandleWebhook(providerName string, r *http.Request) error {
+	p, err := provider(providerName)
+	if err != nil {
+		return err
+	}
+
+	event, err := p.ParseWebhook(r)
+	if err != nil {
+		return err
+	}
+
+	err = applyEvent(p.Name(), event)
+	if errors.Is(err, ErrPaymentNotFound) || errors.Is(err, ErrRefundNotFound) {
+		log.Printf("Ignoring %s webhook for unknown reference %q", providerName, event.ProviderRef)
+		return nil
+	}
+	return err
+}
+
+// RefundPayment refunds amount of a payment, or all that is left of it if
+// amount is nil
+func RefundPayment(ctx context.Context, paymentID string, amount *model.Money, reason *string, actorID string) (*model.Payment, error) {
+	paymentUUID, err := uuid.FromString(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	refundReason := ""
+	if reason != nil {
+		refundReason = *reason
+	}
+
+	if _, err := Refund(ctx, paymentUUID, amount, refundReason, &actorUUID); err != nil {
+		return nil, err
+	}
+
+	return loadPayment(paymentUUID)
+}
+
+type RefundHook func(tx *gorm.DB, refund *models.PaymentRefund) error
+
+// Refund sends a refund to the payment's provider. Some providers settle
+// refunds later through a webhook, in which case the returned refund is
+// still PENDING.
+func Refund(ctx context.Context, paymentID uuid.UUID, amount *model.Money, reason string, actorID *uuid.UUID) (*models.PaymentRefund, error) {
+	return RefundWithHook(ctx, paymentID, amount, reason, actorID, nil)
+}
+
+// RefundWithHook behaves like Refund but calls onCreate in the transaction
+// that records the refund, before the provider is asked for it, so callers
+// can tie their own records to the refund or call it off.
+func RefundWithHook(ctx context.Context, paymentID uuid.UUID, amount *model.Money, reason string, actorID *uuid.UUID, onCreate RefundHook) (*models.PaymentRefund, error) {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", paymentID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrPaymentNotFound
+	}
+
+	if !payment.Status.IsCaptured() || payment.Status == models.PaymentStatusRefunded {
+		tx.Rollback()
+		return nil, ErrPaymentNotRefundable
+	}
+
+	p, err := provider(payment.Provider)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Refunds still in flight count against what is left
+	var pending []models.PaymentRefund
+	if err := tx.Where("payment_id = ? AND status = ?", payment.ID, models.RefundStatusPending).Find(&pending).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	remaining, err := payment.Amount.Sub(payment.RefundedAmount)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, refund := range pending {
+		remaining, err = remaining.Sub(refund.Amount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	refundAmount := remaining
+	if amount != nil {
+		refundAmount = *amount
+	}
+	if refundAmount.Currency != remaining.Currency || refundAmount.Amount <= 0 || refundAmount.Amount > remaining.Amount {
+		tx.Rollback()
+		return nil, ErrInvalidRefundAmount
+	}
+
+	refund := models.PaymentRefund{
+		PaymentID: payment.ID,
+		Status:    models.RefundStatusPending,
+		Amount:    refundAmount,
+		Reason:    reason,
+		ActorID:   actorID,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if onCreate != nil {
+		if err := onCreate(tx, &refund); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	providerRef := ""
+	if payment.ProviderRef != nil {
+		providerRef = *payment.ProviderRef
+	}
+
+	result, err := p.Refund(ctx, RefundRequest{
+		RefundID:      refund.ID,
+		ProviderRef:   providerRef,
+		Receipt:       payment.Receipt,
+		Amount:        refund.Amount,
+		PaymentAmount: payment.Amount,
+		Reason:        reason,
+	})
+	if err != nil {
+		if updateErr := utils.DB.Model(&refund).Updates(map[string]interface{}{
+			"status":         models.RefundStatusFailed,
+			"failure_reason": err.Error(),
+		}).Error; updateErr != nil {
+			log.Printf("Failed to record failed refund %s: %v", refund.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	tx = utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", paymentID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, "id = ?", refund.ID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	refund.ProviderRef = &result.ProviderRef
+	if err := tx.Model(&refund).Update("provider_ref", refund.ProviderRef).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if result.Succeeded && refund.Status == models.RefundStatusPending {
+		if err := completeRefund(tx, &payment, &refund); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// applyEvent records what a provider reported. Providers repeat callbacks,
+// so events for payments and refunds that are already settled are ignored.
+func applyEvent(providerName string, event *Event) error {
+	switch event.Type {
+	case EventPaymentCaptured, EventPaymentFailed:
+		return applyPaymentEvent(providerName, event)
+	case EventRefundSucceeded, EventRefundFailed:
+		return applyRefundEvent(providerName, event)
+	}
+	return nil
+}
+
+func applyPaymentEvent(providerName string, event *Event) error {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("provider = ? AND provider_ref = ?", providerName, event.ProviderRef).
+		First(&payment).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentNotFound
+		}
+		return err
+	}
+
+	if payment.Status != models.PaymentStatusPending {
+		tx.Rollback()
+		return nil
+	}
+
+	if event.Type == EventPaymentFailed {
+		if err := tx.Model(&payment).Updates(map[string]interface{}{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": event.FailureReason,
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      models.PaymentStatusCaptured,
+		"captured_at": now,
+	}
+	if event.Receipt != "" {
+		updates["receipt"] = event.Receipt
+	}
+	if err := tx.Model(&payment).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", payment.OrderID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	paidInFull := event.Amount == nil ||
+		(event.Amount.Currency == payment.Amount.Currency && event.Amount.Amount >= payment.Amount.Amount)
+
+	transitioned := false
+	switch {
+	case !paidInFull:
+		log.Printf("Payment %s captured %s of %s; order %s left pending", payment.ID, event.Amount, payment.Amount, order.ID)
+	case order.Status != models.OrderStatusPending:
+		// e.g. cancelled while the customer was paying; needs a refund
+		log.Printf("Payment %s captured for order %s in status %s", payment.ID, order.ID, order.Status)
+	default:
+		note := fmt.Sprintf("Payment captured via %s", providerName)
+		if event.Receipt != "" {
+			note += " (" + event.Receipt + ")"
+		}
+		if err := orders.Transition(tx, &order, models.OrderStatusProcessing, nil, note); err != nil {
+			tx.Rollback()
+			return err
+		}
+		transitioned = true
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	if transitioned {
+		if err := orders.NotifyStatusChange(order.ID); err != nil {
+			log.Printf("Failed to send status notifications for order %s: %v", order.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func applyRefundEvent(providerName string, event *Event) error {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var refund models.PaymentRefund
+	if err := tx.Joins("JOIN payments ON payments.id = payment_refunds.payment_id").
+		Where("payments.provider = ? AND payment_refunds.provider_ref = ?", providerName, event.ProviderRef).
+		First(&refund).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefundNotFound
+		}
+		return err
+	}
+
+	// Lock the payment before the refund, in the same order as Refund
+	var payment models.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, "id = ?", refund.PaymentID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, "id = ?", refund.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if refund.Status != models.RefundStatusPending {
+		tx.Rollback()
+		return nil
+	}
+
+	if event.Type == EventRefundFailed {
+		if err := tx.Model(&refund).Updates(map[string]interface{}{
+			"status":         models.RefundStatusFailed,
+			"failure_reason": event.FailureReason,
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+
+	if err := completeRefund(tx, &payment, &refund); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// completeRefund marks a refund as paid out and adds it to the payment's
+// refunded amount. A return waiting on the refund is marked refunded with
+// it. The payment and refund rows must be locked.
+func completeRefund(tx *gorm.DB, payment *models.Payment, refund *models.PaymentRefund) error {
+	refunded, err := payment.RefundedAmount.Add(refund.Amount)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.ReturnRequest{}).
+		Where("payment_refund_id = ? AND status = ?", refund.ID, models.ReturnStatusReceived).
+		Update("status", models.ReturnStatusRefunded).Error; err != nil {
+		return err
+	}
+
+	status := models.PaymentStatusPartiallyRefunded
+	if refunded.Amount >= payment.Amount.Amount {
+		status = models.PaymentStatusRefunded
+	}
+
+	if err := tx.Model(refund).Update("status", models.RefundStatusSucceeded).Error; err != nil {
+		return err
+	}
+
+	payment.RefundedAmount = refunded
+	payment.Status = status
+	return tx.Model(payment).Updates(map[string]interface{}{
+		"refunded_amount_amount":   refunded.Amount,
+		"refunded_amount_currency": refunded.Currency,
+		"status":                   status,
+	}).Error
+}
+
+// authorizePayment allows the order's customer, and anyone when anyPayment
+// is set
+func authorizePayment(payment *models.Payment, userID string, anyPayment bool) error {
+	if anyPayment {
+		return nil
+	}
+
+	var order models.Order
+	if err := utils.DB.First(&order, "id = ?", payment.OrderID).Error; err != nil {
+		return err
+	}
+	if order.CustomerID.String() != userID {
+		return errors.New("unauthorized access to payment")
+	}
+	return nil
+}
+
+func loadPayment(id uuid.UUID) (*model.Payment, error) {
+	var payment models.Payment
+	if err := utils.DB.Preload("Refunds", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).First(&payment, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return payment.ToGraphQL(), nil
+}
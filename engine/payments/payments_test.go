@@ -0,0 +1,140 @@
+package payments
+
+import (
+	"context"
+	"ecommerce-service/engine/orders"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// createOrder places a pending order for a new customer
+func createOrder(t *testing.T) (*models.User, *model.Order) {
+	t.Helper()
+
+	customer := utils.CreateTestCustomer(t)
+	product := models.Product{
+		Name:  "Payment Product",
+		Price: model.NewMoney(1999, model.DefaultCurrency()),
+		SKU:   "TEST-" + uuid.NewV4().String(),
+		Stock: 1,
+	}
+	if err := utils.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := orders.CreateOrder(model.OrderInput{
+		Items: []*model.OrderItemInput{{ProductID: product.ID.String(), Quantity: 1}},
+	}, customer.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return customer, order
+}
+
+// addPendingPayment records an earlier attempt to pay the order
+func addPendingPayment(t *testing.T, order *model.Order, providerRef *string, createdAt time.Time) *models.Payment {
+	t.Helper()
+
+	payment := models.Payment{
+		OrderID:        uuid.FromStringOrNil(order.ID),
+		Provider:       "stripe",
+		ProviderRef:    providerRef,
+		Status:         models.PaymentStatusPending,
+		Amount:         order.Total,
+		RefundedAmount: model.NewMoney(0, order.Total.Currency),
+	}
+	if err := utils.DB.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Model(&payment).UpdateColumn("created_at", createdAt).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &payment
+}
+
+func paymentStatus(t *testing.T, paymentID uuid.UUID) models.PaymentStatus {
+	t.Helper()
+
+	var payment models.Payment
+	if err := utils.DB.First(&payment, "id = ?", paymentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return payment.Status
+}
+
+func TestInitiatePaymentSupersedesStalePayments(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	t.Run("never reached the provider", func(t *testing.T) {
+		customer, order := createOrder(t)
+		Register(stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/payment_intents" {
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			fmt.Fprint(w, `{"id": "pi_new", "client_secret": "pi_new_secret", "status": "requires_payment_method"}`)
+		}))
+
+		// Another attempt may still be waiting on the provider
+		recent := addPendingPayment(t, order, nil, time.Now())
+		_, err := InitiatePayment(context.Background(), order.ID, customer.ID.String(), "stripe", nil)
+		if !errors.Is(err, ErrPaymentInProgress) {
+			t.Fatalf("got %v, want ErrPaymentInProgress while the attempt is recent", err)
+		}
+
+		if err := utils.DB.Model(recent).UpdateColumn("created_at", time.Now().Add(-time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+		session, err := InitiatePayment(context.Background(), order.ID, customer.ID.String(), "stripe", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.ClientSecret == nil || *session.ClientSecret != "pi_new_secret" {
+			t.Errorf("got client secret %v, want the new intent's", session.ClientSecret)
+		}
+		if status := paymentStatus(t, recent.ID); status != models.PaymentStatusFailed {
+			t.Errorf("stale payment is %s, want FAILED", status)
+		}
+	})
+
+	t.Run("abandoned intent", func(t *testing.T) {
+		customer, order := createOrder(t)
+		cancelled := false
+		Register(stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path {
+			case "GET /v1/payment_intents/pi_old":
+				fmt.Fprint(w, `{"id": "pi_old", "status": "requires_payment_method"}`)
+			case "POST /v1/payment_intents/pi_old/cancel":
+				cancelled = true
+				fmt.Fprint(w, `{"id": "pi_old", "status": "canceled"}`)
+			case "POST /v1/payment_intents":
+				fmt.Fprint(w, `{"id": "pi_new", "client_secret": "pi_new_secret", "status": "requires_payment_method"}`)
+			default:
+				t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			}
+		}))
+
+		ref := "pi_old"
+		abandoned := addPendingPayment(t, order, &ref, time.Now())
+		session, err := InitiatePayment(context.Background(), order.ID, customer.ID.String(), "stripe", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cancelled {
+			t.Error("the abandoned intent was not cancelled")
+		}
+		if status := paymentStatus(t, abandoned.ID); status != models.PaymentStatusFailed {
+			t.Errorf("abandoned payment is %s, want FAILED", status)
+		}
+		if session.ClientSecret == nil || *session.ClientSecret != "pi_new_secret" {
+			t.Errorf("got client secret %v, want the new intent's", session.ClientSecret)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package payments
+
+import (
+	"context"
+	"ecommerce-service/graph/model"
+	"net/http"
+	"os"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PaymentProvider is implemented by each payment gateway adapter. Providers
+// only talk to the gateway; recording payments and moving orders along is
+// done by this package.
+type PaymentProvider interface {
+	// Name is the provider's key in the registry and in webhook URLs
+	Name() string
+	// Initiate starts collecting a payment, e.g. by sending an M-Pesa STK
+	// push or creating a card payment intent
+	Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error)
+	// Confirm asks the gateway for the current state of a payment
+	Confirm(ctx context.Context, providerRef string) (*Event, error)
+	// Refund returns some or all of a captured payment
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+	// ParseWebhook verifies a callback from the gateway and turns it into
+	// an event
+	ParseWebhook(r *http.Request) (*Event, error)
+}
+
+// PaymentCanceller is implemented by providers that can call off a payment
+// the customer hasn't completed, so that a new attempt can replace it.
+// Payments with other providers stay pending until the gateway settles them.
+type PaymentCanceller interface {
+	Cancel(ctx context.Context, providerRef string) error
+}
+
+type InitiateRequest struct {
+	PaymentID   uuid.UUID
+	OrderID     uuid.UUID
+	Amount      model.Money
+	PhoneNumber string // M-Pesa number to prompt
+	Description string
+}
+
+type InitiateResult struct {
+	ProviderRef     string
+	ClientSecret    string // For client-side card collection
+	CustomerMessage string
+}
+
+type RefundRequest struct {
+	RefundID      uuid.UUID
+	ProviderRef   string // The payment's reference
+	Receipt       string // The payment's receipt, which some gateways refund against
+	Amount        model.Money
+	PaymentAmount model.Money // The whole payment, for gateways that can only refund all of it
+	Reason        string
+}
+
+type RefundResult struct {
+	ProviderRef string
+	Succeeded   bool // False while the gateway is still processing the refund
+}
+
+type EventType string
+
+const (
+	EventPaymentPending  EventType = "PAYMENT_PENDING"
+	EventPaymentCaptured EventType = "PAYMENT_CAPTURED"
+	EventPaymentFailed   EventType = "PAYMENT_FAILED"
+	EventRefundSucceeded EventType = "REFUND_SUCCEEDED"
+	EventRefundFailed    EventType = "REFUND_FAILED"
+	EventUnhandled       EventType = "UNHANDLED"
+)
+
+// Event is something the gateway reports about a payment or a refund.
+// ProviderRef is the payment's reference for payment events and the
+// refund's for refund events.
+type Event struct {
+	Type          EventType
+	ProviderRef   string
+	Receipt       string
+	Amount        *model.Money // Amount captured, when the gateway reports it
+	FailureReason string
+}
+
+var providers = map[string]PaymentProvider{}
+
+// Register makes a provider available under its name, replacing any
+// provider already registered with that name
+func Register(provider PaymentProvider) {
+	providers[provider.Name()] = provider
+}
+
+func provider(name string) (PaymentProvider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// ProviderNames lists the configured providers
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitProviders registers every provider whose credentials are set in the
+// environment
+func InitProviders() {
+	if os.Getenv("MPESA_CONSUMER_KEY") != "" {
+		Register(NewMpesaProvider(MpesaConfigFromEnv()))
+	}
+	if os.Getenv("STRIPE_SECRET_KEY") != "" {
+		Register(NewStripeProvider(StripeConfigFromEnv()))
+	}
+}
@@ -0,0 +1,293 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecommerce-service/graph/model"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhooks signed longer ago than this are rejected as possible replays
+const stripeSignatureTolerance = 5 * time.Minute
+
+type StripeConfig struct {
+	BaseURL       string // https://api.stripe.com
+	SecretKey     string
+	WebhookSecret string
+}
+
+func StripeConfigFromEnv() StripeConfig {
+	return StripeConfig{
+		BaseURL:       os.Getenv("STRIPE_BASE_URL"),
+		SecretKey:     os.Getenv("STRIPE_SECRET_KEY"),
+		WebhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+	}
+}
+
+// StripeProvider takes card payments with Stripe PaymentIntents. The card
+// details are collected client-side with the returned client secret, so
+// they never reach this service.
+type StripeProvider struct {
+	config StripeConfig
+	client *http.Client
+}
+
+func NewStripeProvider(config StripeConfig) *StripeProvider {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.stripe.com"
+	}
+	return &StripeProvider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+type stripePaymentIntent struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"`
+	ClientSecret     string `json:"client_secret"`
+	Amount           int64  `json:"amount"`
+	AmountReceived   int64  `json:"amount_received"`
+	Currency         string `json:"currency"`
+	LatestCharge     string `json:"latest_charge"`
+	LastPaymentError *struct {
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+type stripeRefund struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason"`
+}
+
+func (p *StripeProvider) Initiate(ctx context.Context, req InitiateRequest) (*InitiateResult, error) {
+	// Stripe takes amounts in the currency's minor unit, as Money stores them
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount.Amount, 10))
+	form.Set("currency", strings.ToLower(req.Amount.Currency))
+	form.Set("description", req.Description)
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("metadata[payment_id]", req.PaymentID.String())
+	form.Set("metadata[order_id]", req.OrderID.String())
+
+	var intent stripePaymentIntent
+	if err := p.request(ctx, http.MethodPost, "/v1/payment_intents", form, req.PaymentID.String(), &intent); err != nil {
+		return nil, err
+	}
+
+	return &InitiateResult{
+		ProviderRef:  intent.ID,
+		ClientSecret: intent.ClientSecret,
+	}, nil
+}
+
+func (p *StripeProvider) Confirm(ctx context.Context, providerRef string) (*Event, error) {
+	var intent stripePaymentIntent
+	if err := p.request(ctx, http.MethodGet, "/v1/payment_intents/"+url.PathEscape(providerRef), nil, "", &intent); err != nil {
+		return nil, err
+	}
+
+	return intentEvent(&intent), nil
+}
+
+func (p *StripeProvider) Cancel(ctx context.Context, providerRef string) error {
+	form := url.Values{}
+	form.Set("cancellation_reason", "abandoned")
+
+	var intent stripePaymentIntent
+	if err := p.request(ctx, http.MethodPost, "/v1/payment_intents/"+url.PathEscape(providerRef)+"/cancel", form, "", &intent); err != nil {
+		return err
+	}
+	if intent.Status != "canceled" {
+		return fmt.Errorf("stripe: payment intent %s is %s, not canceled", intent.ID, intent.Status)
+	}
+	return nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	form := url.Values{}
+	form.Set("payment_intent", req.ProviderRef)
+	form.Set("amount", strconv.FormatInt(req.Amount.Amount, 10))
+	form.Set("metadata[refund_id]", req.RefundID.String())
+
+	var refund stripeRefund
+	if err := p.request(ctx, http.MethodPost, "/v1/refunds", form, req.RefundID.String(), &refund); err != nil {
+		return nil, err
+	}
+	if refund.Status == "failed" || refund.Status == "canceled" {
+		return nil, fmt.Errorf("stripe: refund %s: %s", refund.Status, refund.FailureReason)
+	}
+
+	return &RefundResult{
+		ProviderRef: refund.ID,
+		Succeeded:   refund.Status == "succeeded",
+	}, nil
+}
+
+func (p *StripeProvider) ParseWebhook(r *http.Request) (*Event, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.verifySignature(r.Header.Get("Stripe-Signature"), body, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	switch event.Type {
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+		var intent stripePaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return nil, ErrInvalidWebhook
+		}
+		return intentEvent(&intent), nil
+	case "refund.updated", "charge.refund.updated":
+		var refund stripeRefund
+		if err := json.Unmarshal(event.Data.Object, &refund); err != nil {
+			return nil, ErrInvalidWebhook
+		}
+		switch refund.Status {
+		case "succeeded":
+			return &Event{Type: EventRefundSucceeded, ProviderRef: refund.ID}, nil
+		case "failed", "canceled":
+			return &Event{Type: EventRefundFailed, ProviderRef: refund.ID, FailureReason: refund.FailureReason}, nil
+		}
+	}
+
+	return &Event{Type: EventUnhandled}, nil
+}
+
+// verifySignature checks the Stripe-Signature header, which has the form
+// t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">[,v1=...]
+func (p *StripeProvider) verifySignature(header string, body []byte, now time.Time) error {
+	if p.config.WebhookSecret == "" {
+		return ErrInvalidWebhook
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidWebhook
+	}
+	if now.Sub(time.Unix(seconds, 0)) > stripeSignatureTolerance {
+		return ErrInvalidWebhook
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.config.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidWebhook
+}
+
+func intentEvent(intent *stripePaymentIntent) *Event {
+	switch intent.Status {
+	case "succeeded":
+		received := model.NewMoney(intent.AmountReceived, strings.ToUpper(intent.Currency))
+		return &Event{
+			Type:        EventPaymentCaptured,
+			ProviderRef: intent.ID,
+			Receipt:     intent.LatestCharge,
+			Amount:      &received,
+		}
+	case "canceled":
+		return &Event{Type: EventPaymentFailed, ProviderRef: intent.ID, FailureReason: "payment was cancelled"}
+	case "requires_payment_method":
+		// Only a failure once an attempt has been made
+		if intent.LastPaymentError != nil {
+			return &Event{Type: EventPaymentFailed, ProviderRef: intent.ID, FailureReason: intent.LastPaymentError.Message}
+		}
+	}
+	return &Event{Type: EventPaymentPending, ProviderRef: intent.ID}
+}
+
+func (p *StripeProvider) request(ctx context.Context, method string, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.config.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.config.SecretKey)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	// Retried requests with the same key are not repeated by Stripe
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %s", apiErr.Error.Message)
+		}
+		return fmt.Errorf("stripe: %s returned status %d", path, resp.StatusCode)
+	}
+
+	return json.Unmarshal(data, out)
+}
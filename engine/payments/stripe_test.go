@@ -0,0 +1,226 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecommerce-service/graph/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// stripeServer fakes the Stripe API with handler and returns a provider
+// talking to it
+func stripeServer(t *testing.T, handler http.HandlerFunc) *StripeProvider {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer sk_test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewStripeProvider(StripeConfig{
+		BaseURL:       server.URL,
+		SecretKey:     "sk_test",
+		WebhookSecret: testWebhookSecret,
+	})
+}
+
+func TestStripeInitiate(t *testing.T) {
+	paymentID := uuid.NewV4()
+	p := stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/payment_intents" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Idempotency-Key"); got != paymentID.String() {
+			t.Errorf("Idempotency-Key = %q, want the payment ID", got)
+		}
+		if got := r.PostForm.Get("amount"); got != "1999" {
+			t.Errorf("amount = %q, want minor units", got)
+		}
+		if got := r.PostForm.Get("currency"); got != "usd" {
+			t.Errorf("currency = %q", got)
+		}
+		if got := r.PostForm.Get("metadata[payment_id]"); got != paymentID.String() {
+			t.Errorf("metadata[payment_id] = %q", got)
+		}
+		fmt.Fprint(w, `{"id": "pi_123", "client_secret": "pi_123_secret_abc", "status": "requires_payment_method"}`)
+	})
+
+	result, err := p.Initiate(context.Background(), InitiateRequest{
+		PaymentID:   paymentID,
+		OrderID:     uuid.NewV4(),
+		Amount:      model.NewMoney(1999, "USD"),
+		Description: "Order #12345678",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ProviderRef != "pi_123" || result.ClientSecret != "pi_123_secret_abc" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestStripeInitiateError(t *testing.T) {
+	p := stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": {"message": "Invalid currency: xyz"}}`)
+	})
+
+	_, err := p.Initiate(context.Background(), InitiateRequest{
+		PaymentID: uuid.NewV4(),
+		OrderID:   uuid.NewV4(),
+		Amount:    model.NewMoney(100, "XYZ"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "Invalid currency") {
+		t.Errorf("got error %v, want Stripe's message", err)
+	}
+}
+
+func TestStripeRefund(t *testing.T) {
+	tests := []struct {
+		status    string
+		succeeded bool
+		wantErr   bool
+	}{
+		{status: "succeeded", succeeded: true},
+		{status: "pending", succeeded: false},
+		{status: "failed", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			refundID := uuid.NewV4()
+			p := stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/refunds" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				if got := r.Header.Get("Idempotency-Key"); got != refundID.String() {
+					t.Errorf("Idempotency-Key = %q, want the refund ID", got)
+				}
+				if got := r.PostForm.Get("payment_intent"); got != "pi_123" {
+					t.Errorf("payment_intent = %q", got)
+				}
+				if got := r.PostForm.Get("amount"); got != "500" {
+					t.Errorf("amount = %q", got)
+				}
+				fmt.Fprintf(w, `{"id": "re_123", "status": %q, "failure_reason": "expired_or_canceled_card"}`, test.status)
+			})
+
+			result, err := p.Refund(context.Background(), RefundRequest{
+				RefundID:      refundID,
+				ProviderRef:   "pi_123",
+				Amount:        model.NewMoney(500, "USD"),
+				PaymentAmount: model.NewMoney(1999, "USD"),
+			})
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ProviderRef != "re_123" || result.Succeeded != test.succeeded {
+				t.Errorf("got %+v", result)
+			}
+		})
+	}
+}
+
+// stripeWebhook builds a webhook request signed with secret at the given time
+func stripeWebhook(body string, secret string, signedAt time.Time) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(body))
+	r.Header.Set("Stripe-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	p := NewStripeProvider(StripeConfig{SecretKey: "sk_test", WebhookSecret: testWebhookSecret})
+
+	captured := `{"type": "payment_intent.succeeded", "data": {"object": {"id": "pi_123", "status": "succeeded",
+		"amount_received": 1999, "currency": "usd", "latest_charge": "ch_123"}}}`
+	event, err := p.ParseWebhook(stripeWebhook(captured, testWebhookSecret, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := model.NewMoney(1999, "USD")
+	if event.Type != EventPaymentCaptured || event.ProviderRef != "pi_123" || event.Receipt != "ch_123" ||
+		event.Amount == nil || *event.Amount != want {
+		t.Errorf("got %+v", event)
+	}
+
+	refunded := `{"type": "refund.updated", "data": {"object": {"id": "re_123", "status": "failed", "failure_reason": "lost_or_stolen_card"}}}`
+	event, err = p.ParseWebhook(stripeWebhook(refunded, testWebhookSecret, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventRefundFailed || event.ProviderRef != "re_123" || event.FailureReason != "lost_or_stolen_card" {
+		t.Errorf("got %+v", event)
+	}
+}
+
+func TestStripeParseWebhookRejectsBadSignatures(t *testing.T) {
+	p := NewStripeProvider(StripeConfig{SecretKey: "sk_test", WebhookSecret: testWebhookSecret})
+	body := `{"type": "payment_intent.succeeded", "data": {"object": {"id": "pi_123", "status": "succeeded"}}}`
+
+	tampered := stripeWebhook(body, testWebhookSecret, time.Now())
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Replace(body, "pi_123", "pi_456", 1))).Body
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(body))
+
+	requests := map[string]*http.Request{
+		"wrong secret": stripeWebhook(body, "whsec_other", time.Now()),
+		"replayed":     stripeWebhook(body, testWebhookSecret, time.Now().Add(-time.Hour)),
+		"tampered":     tampered,
+		"unsigned":     unsigned,
+	}
+	for name, r := range requests {
+		if _, err := p.ParseWebhook(r); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("%s: got %v, want ErrInvalidWebhook", name, err)
+		}
+	}
+}
+
+func TestStripeCancel(t *testing.T) {
+	p := stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/payment_intents/pi_123/cancel" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"id": "pi_123", "status": "canceled"}`)
+	})
+	if err := p.Cancel(context.Background(), "pi_123"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Intents that are already processing can't be cancelled
+	p = stripeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": {"message": "This PaymentIntent's status is processing"}}`)
+	})
+	if err := p.Cancel(context.Background(), "pi_123"); err == nil {
+		t.Error("expected an error")
+	}
+}
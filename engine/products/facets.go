@@ -0,0 +1,256 @@
+package products
+
+import (
+	"ecommerce-service/engine/categories"
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"strconv"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// Number of equal-width price buckets when no boundaries are given
+const defaultPriceBuckets = 5
+
+var ErrInvalidPriceBoundaries = errors.New("price boundaries must be positive, increasing and in one currency")
+
+// GetProductFacets counts the products matching a search, category and
+// filter by subcategory, price band, stock and variant option. Counts are
+// computed in the database; only the totals come back.
+func GetProductFacets(search *string, categoryID *string, filter *model.ProductFilter, priceBoundaries []*model.Money) (*model.ProductFacets, error) {
+	matching := inventory.ListedProducts(utils.DB.Model(&models.Product{})).Select("products.id")
+
+	if search != nil && *search != "" {
+		var err error
+		matching, err = searchCondition(matching, *search)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Browsing a category includes everything below it
+	var scope *uuid.UUID
+	if categoryID != nil {
+		catUUID, err := uuid.FromString(*categoryID)
+		if err != nil {
+			return nil, err
+		}
+		scope = &catUUID
+		matching = matching.Where(
+			"products.id IN (SELECT product_id FROM category_products WHERE category_id IN (?))",
+			categories.SubtreeIDs(utils.DB, catUUID),
+		)
+	}
+
+	matching, err := applyProductFilter(matching, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	facets := &model.ProductFacets{}
+
+	var stock struct {
+		Total      int64
+		InStock    int64
+		OutOfStock int64
+	}
+	if err := utils.DB.Raw(`SELECT COUNT(*) AS total,
+			COUNT(*) FILTER (WHERE stock > 0) AS in_stock,
+			COUNT(*) FILTER (WHERE stock <= 0) AS out_of_stock
+		FROM products WHERE id IN (?)`, matching).
+		Scan(&stock).Error; err != nil {
+		return nil, err
+	}
+	facets.TotalCount = int32(stock.Total)
+	facets.InStock = int32(stock.InStock)
+	facets.OutOfStock = int32(stock.OutOfStock)
+
+	if facets.Categories, err = categoryFacets(matching, scope); err != nil {
+		return nil, err
+	}
+	if facets.PriceBuckets, err = priceFacets(matching, priceBoundaries); err != nil {
+		return nil, err
+	}
+	if facets.Options, err = optionFacets(matching); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// categoryFacets counts matching products under each category, including
+// those in its descendants. With a scope only the categories below it are
+// counted.
+func categoryFacets(matching *gorm.DB, scope *uuid.UUID) ([]*model.CategoryFacet, error) {
+	roots := utils.DB.Table("categories").Select("id")
+	if scope != nil {
+		roots = roots.Where("id IN (?) AND id <> ?", categories.SubtreeIDs(utils.DB, *scope), *scope)
+	}
+
+	var rows []struct {
+		CategoryID uuid.UUID
+		Name       string
+		ParentID   *uuid.UUID
+		Level      int
+		Count      int64
+	}
+	if err := utils.DB.Raw(`WITH RECURSIVE tree AS (
+			SELECT id AS facet_id, id FROM categories WHERE id IN (?)
+			UNION ALL
+			SELECT tree.facet_id, categories.id FROM categories JOIN tree ON categories.parent_id = tree.id
+		)
+		SELECT categories.id AS category_id, categories.name, categories.parent_id, categories.level,
+			COUNT(DISTINCT category_products.product_id) AS count
+		FROM tree
+		JOIN category_products ON category_products.category_id = tree.id
+		JOIN categories ON categories.id = tree.facet_id
+		WHERE category_products.product_id IN (?)
+		GROUP BY categories.id, categories.name, categories.parent_id, categories.level
+		ORDER BY categories.level, categories.name`, roots, matching).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.CategoryFacet, len(rows))
+	for i, row := range rows {
+		result[i] = &model.CategoryFacet{
+			CategoryID: row.CategoryID.String(),
+			Name:       row.Name,
+			Level:      int32(row.Level),
+			Count:      int32(row.Count),
+		}
+		if row.ParentID != nil {
+			parentID := row.ParentID.String()
+			result[i].ParentID = &parentID
+		}
+	}
+
+	return result, nil
+}
+
+// priceFacets counts matching products per price band. The bands run from
+// zero to the first boundary, between each pair of boundaries, and from the
+// last one up. Without boundaries the range of matching prices in the
+// default currency is split evenly. Only products priced in the bands'
+// currency are counted, as with the price filters.
+func priceFacets(matching *gorm.DB, boundaries []*model.Money) ([]*model.PriceBucket, error) {
+	currency := model.DefaultCurrency()
+	if len(boundaries) > 0 {
+		currency = boundaries[0].Currency
+	}
+
+	amounts := make([]int64, 0, len(boundaries))
+	for i, boundary := range boundaries {
+		if boundary.Currency != currency || boundary.Amount <= 0 || (i > 0 && boundary.Amount <= amounts[i-1]) {
+			return nil, ErrInvalidPriceBoundaries
+		}
+		amounts = append(amounts, boundary.Amount)
+	}
+
+	if len(amounts) == 0 {
+		var bounds struct {
+			Low  *int64
+			High *int64
+		}
+		if err := utils.DB.Raw(`SELECT MIN(price_amount) AS low, MAX(price_amount) AS high
+			FROM products WHERE id IN (?) AND price_currency = ?`, matching, currency).
+			Scan(&bounds).Error; err != nil {
+			return nil, err
+		}
+		if bounds.Low == nil {
+			return []*model.PriceBucket{}, nil
+		}
+
+		width := (*bounds.High - *bounds.Low + defaultPriceBuckets) / defaultPriceBuckets
+		for i := int64(1); i < defaultPriceBuckets; i++ {
+			if amount := *bounds.Low + width*i; amount > 0 && amount <= *bounds.High {
+				amounts = append(amounts, amount)
+			}
+		}
+	}
+
+	// width_bucket returns 0 below the first boundary and i from the i-th up
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	query := utils.DB.Raw(`SELECT width_bucket(price_amount, ?::bigint[]) AS bucket, COUNT(*) AS count
+		FROM products WHERE id IN (?) AND price_currency = ?
+		GROUP BY bucket`, pgArray(amounts), matching, currency)
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Bucket] = row.Count
+	}
+
+	buckets := make([]*model.PriceBucket, len(amounts)+1)
+	for i := range buckets {
+		bucket := &model.PriceBucket{
+			Min:   model.NewMoney(0, currency),
+			Count: int32(counts[i]),
+		}
+		if i > 0 {
+			bucket.Min = model.NewMoney(amounts[i-1], currency)
+		}
+		if i < len(amounts) {
+			upper := model.NewMoney(amounts[i], currency)
+			bucket.Max = &upper
+		}
+		buckets[i] = bucket
+	}
+
+	return buckets, nil
+}
+
+// optionFacets counts matching products offered in each option value, e.g.
+// how many come in Size M
+func optionFacets(matching *gorm.DB) ([]*model.OptionFacet, error) {
+	var rows []struct {
+		Name  string
+		Value string
+		Count int64
+	}
+	if err := utils.DB.Raw(`SELECT product_options.name, product_option_values.value,
+			COUNT(DISTINCT product_variants.product_id) AS count
+		FROM product_variants
+		JOIN product_variant_option_values ON product_variant_option_values.product_variant_id = product_variants.id
+		JOIN product_option_values ON product_option_values.id = product_variant_option_values.product_option_value_id
+		JOIN product_options ON product_options.id = product_option_values.option_id
+		WHERE product_variants.product_id IN (?)
+		GROUP BY product_options.name, product_option_values.value
+		ORDER BY product_options.name, MIN(product_option_values.position), product_option_values.value`, matching).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.OptionFacet, 0)
+	for _, row := range rows {
+		if len(result) == 0 || result[len(result)-1].Name != row.Name {
+			result = append(result, &model.OptionFacet{Name: row.Name})
+		}
+		facet := result[len(result)-1]
+		facet.Values = append(facet.Values, &model.OptionValueCount{
+			Value: row.Value,
+			Count: int32(row.Count),
+		})
+	}
+
+	return result, nil
+}
+
+// pgArray renders amounts as a Postgres array literal
+func pgArray(amounts []int64) string {
+	values := make([]string, len(amounts))
+	for i, amount := range amounts {
+		values[i] = strconv.FormatInt(amount, 10)
+	}
+	return "{" + strings.Join(values, ",") + "}"
+}
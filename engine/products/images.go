@@ -0,0 +1,257 @@
+package products
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/engine/media"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var ErrImageNotFound = errors.New("image not found")
+
+func GetProductImages(productID string) ([]*model.ProductImage, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []models.ProductImage
+	if err := utils.DB.Where("product_id = ?", productUUID).
+		Order("position, created_at").
+		Find(&images).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.ProductImage, len(images))
+	for i, image := range images {
+		result[i] = image.ToGraphQL(media.Store().URL)
+	}
+
+	return result, nil
+}
+
+// UploadProductImage stores an image and its thumbnail and adds it after
+// the product's other images. A product's first image becomes its primary
+// image.
+func UploadProductImage(ctx context.Context, productID string, file io.Reader, altText *string, primary *bool) (*model.ProductImage, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var product models.Product
+	if err := utils.DB.First(&product, "id = ?", productUUID).Error; err != nil {
+		return nil, err
+	}
+
+	upload, err := media.ProcessImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blobs are written before the row so a saved image always has its
+	// files; they are removed again if the row can't be saved
+	store := media.Store()
+	name := uuid.NewV4().String()
+	image := models.ProductImage{
+		ProductID:    productUUID,
+		Key:          fmt.Sprintf("products/%s/%s%s", productUUID, name, upload.Extension),
+		ThumbnailKey: fmt.Sprintf("products/%s/%s_thumb%s", productUUID, name, upload.ThumbnailExtension),
+		ContentType:  upload.ContentType,
+		Width:        upload.Width,
+		Height:       upload.Height,
+	}
+	if altText != nil {
+		image.AltText = strings.TrimSpace(*altText)
+	}
+
+	if err := store.Put(ctx, image.Key, bytes.NewReader(upload.Data), upload.ContentType); err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, image.ThumbnailKey, bytes.NewReader(upload.Thumbnail), upload.ThumbnailContentType); err != nil {
+		deleteBlobs(ctx, image.Key)
+		return nil, err
+	}
+
+	if err := saveNewImage(&image, primary != nil && *primary); err != nil {
+		deleteBlobs(ctx, image.Key, image.ThumbnailKey)
+		return nil, err
+	}
+
+	return image.ToGraphQL(store.URL), nil
+}
+
+func UpdateProductImage(id string, input model.ProductImageInput) (*model.ProductImage, error) {
+	image, err := findImage(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.AltText != nil {
+		image.AltText = strings.TrimSpace(*input.AltText)
+	}
+	if input.Position != nil {
+		image.Position = int(*input.Position)
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The primary image moves by making another image primary, so it
+	// can't simply be switched off
+	if input.IsPrimary != nil && *input.IsPrimary && !image.IsPrimary {
+		if err := clearPrimaryImage(tx, image.ProductID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		image.IsPrimary = true
+	}
+
+	if err := tx.Model(&models.ProductImage{}).Where("id = ?", image.ID).Updates(map[string]interface{}{
+		"alt_text":   image.AltText,
+		"position":   image.Position,
+		"is_primary": image.IsPrimary,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return image.ToGraphQL(media.Store().URL), nil
+}
+
+// DeleteProductImage removes the image and its files. If it was the
+// primary image the next one in order takes its place.
+func DeleteProductImage(ctx context.Context, id string) (bool, error) {
+	image, err := findImage(id)
+	if err != nil {
+		return false, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Delete(image).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if image.IsPrimary {
+		var next models.ProductImage
+		err := tx.Where("product_id = ?", image.ProductID).Order("position, created_at").First(&next).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			return false, err
+		}
+		if err == nil {
+			if err := tx.Model(&models.ProductImage{}).Where("id = ?", next.ID).Update("is_primary", true).Error; err != nil {
+				tx.Rollback()
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+
+	deleteBlobs(ctx, image.Key, image.ThumbnailKey)
+	return true, nil
+}
+
+// saveNewImage places the image after the product's others. The product
+// row is locked so concurrent uploads don't pick the same position or both
+// become primary.
+func saveNewImage(image *models.ProductImage, primary bool) error {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := inventory.LockProducts(tx, []uuid.UUID{image.ProductID}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var existing struct {
+		Count        int64
+		NextPosition int
+	}
+	if err := tx.Model(&models.ProductImage{}).
+		Select("COUNT(*) AS count, COALESCE(MAX(position) + 1, 0) AS next_position").
+		Where("product_id = ?", image.ProductID).
+		Scan(&existing).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	image.Position = existing.NextPosition
+	image.IsPrimary = primary || existing.Count == 0
+	if image.IsPrimary {
+		if err := clearPrimaryImage(tx, image.ProductID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Create(image).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func clearPrimaryImage(tx *gorm.DB, productUUID uuid.UUID) error {
+	return tx.Model(&models.ProductImage{}).
+		Where("product_id = ? AND is_primary", productUUID).
+		Update("is_primary", false).Error
+}
+
+func findImage(id string) (*models.ProductImage, error) {
+	imageUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var image models.ProductImage
+	if err := utils.DB.First(&image, "id = ?", imageUUID).Error; err != nil {
+		return nil, ErrImageNotFound
+	}
+
+	return &image, nil
+}
+
+// deleteBlobs removes files that are no longer referenced. Failures only
+// leave orphaned files behind, so they are logged rather than returned.
+func deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := media.Store().Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
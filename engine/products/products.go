@@ -1,14 +1,37 @@
 package products
 
 import (
+	"ecommerce-service/engine/categories"
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/engine/inventory"
 	"ecommerce-service/graph/model"
 	"ecommerce-service/models"
 	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"math"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
 )
 
-func CreateProduct(input model.ProductInput) (*model.Product, error) {
+// Sort key column for each orderable field. CREATED_AT needs no extra key
+// because created_at and id are always appended as tie-breakers.
+var productOrderColumns = map[model.ProductOrderField]string{
+	model.ProductOrderFieldCreatedAt: "",
+	model.ProductOrderFieldPrice:     "products.price_amount",
+	model.ProductOrderFieldName:      "products.name",
+	model.ProductOrderFieldStock:     "products.stock",
+}
+
+var ErrPriceCurrencyMismatch = errors.New("minimum and maximum price must be in the same currency")
+
+func CreateProduct(input model.ProductInput, actorID string) (*model.Product, error) {
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
 	// Convert category IDs to UUIDs
 	categories := make([]models.Category, 0)
 	for _, categoryID := range input.CategoryIds {
@@ -24,26 +47,55 @@ func CreateProduct(input model.ProductInput) (*model.Product, error) {
 		categories = append(categories, category)
 	}
 
-	// Create new product
+	// Create new product. Opening stock goes through the ledger as a receipt.
 	product := models.Product{
 		Name:        input.Name,
 		Description: *input.Description,
 		Price:       input.Price,
 		SKU:         input.Sku,
-		Stock:       int(input.Stock),
+		Stock:       0,
 		Categories:  categories,
 	}
+	if input.Weight != nil {
+		product.Weight = int(*input.Weight)
+	}
 
-	if err := utils.DB.Create(&product).Error; err != nil {
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(&product).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if input.Stock > 0 {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID: product.ID,
+			Delta:     int(input.Stock),
+			Reason:    models.InventoryReasonReceipt,
+			ActorID:   &actorUUID,
+			Note:      "Opening stock",
+		}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		product.Stock = int(input.Stock)
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
 
 	return product.ToGraphQL(), nil
 }
 
-func GetProducts(categoryID *string, search *string) ([]*model.Product, error) {
+func GetProducts(categoryID *string, search *string, includeDescendants bool, currency string) ([]*model.Product, error) {
 	var products []models.Product
-	query := utils.DB.Preload("Categories")
+	query := inventory.ListedProducts(inventory.PreloadProduct(utils.DB))
 
 	// Apply category filter if provided
 	if categoryID != nil {
@@ -51,17 +103,26 @@ func GetProducts(categoryID *string, search *string) ([]*model.Product, error) {
 		if err != nil {
 			return nil, err
 		}
-		query = query.Joins("JOIN category_products cp ON cp.product_id = products.id").
-			Where("cp.category_id = ?", catUUID)
+
+		if includeDescendants {
+			// Subquery so products in several of the categories aren't duplicated
+			query = query.Where(
+				"products.id IN (SELECT product_id FROM category_products WHERE category_id IN (?))",
+				categories.SubtreeIDs(utils.DB, catUUID),
+			)
+		} else {
+			query = query.Joins("JOIN category_products cp ON cp.product_id = products.id").
+				Where("cp.category_id = ?", catUUID)
+		}
 	}
 
 	// Apply search filter if provided
 	if search != nil && *search != "" {
-		searchTerm := "%" + *search + "%"
-		query = query.Where(
-			"products.name ILIKE ? OR products.description ILIKE ? OR products.sku ILIKE ?",
-			searchTerm, searchTerm, searchTerm,
-		)
+		var err error
+		query, err = searchCondition(query, *search)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if err := query.Find(&products).Error; err != nil {
@@ -74,78 +135,387 @@ func GetProducts(categoryID *string, search *string) ([]*model.Product, error) {
 		result[i] = product.ToGraphQL()
 	}
 
+	if err := currencies.ConvertProducts(result, currency); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
-func GetCategoryAveragePrice(categoryID string) (float64, error) {
+func GetProductsConnection(first *int32, after *string, orderBy *model.ProductOrder, filter *model.ProductFilter, currency string) (*model.ProductConnection, error) {
+	order := model.ProductOrder{
+		Field:     model.ProductOrderFieldCreatedAt,
+		Direction: model.SortDirectionDesc,
+	}
+	if orderBy != nil {
+		order = *orderBy
+	}
+
+	sortColumn, ok := productOrderColumns[order.Field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported product order field: %s", order.Field)
+	}
+
+	query, err := applyProductFilter(inventory.ListedProducts(utils.DB.Model(&models.Product{})), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prices in different currencies can't be ordered against each other,
+	// so sorting by price lists only the products priced in one currency
+	if order.Field == model.ProductOrderFieldPrice {
+		query = query.Where("products.price_currency = ?", priceCurrency(filter))
+	}
+
+	var totalCount int64
+	if err := query.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		return nil, err
+	}
+
+	// Keyset columns in sort order
+	keyColumns := "products.created_at, products.id"
+	if sortColumn != "" {
+		keyColumns = sortColumn + ", " + keyColumns
+	}
+
+	comparison := ">"
+	direction := "ASC"
+	if order.Direction == model.SortDirectionDesc {
+		comparison = "<"
+		direction = "DESC"
+	}
+
+	if after != nil && *after != "" {
+		cursor, err := utils.DecodeCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+
+		cursorID, err := uuid.FromString(cursor.ID)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+
+		if sortColumn != "" {
+			value, err := cursorValue(cursor.Value, order.Field)
+			if err != nil {
+				return nil, err
+			}
+
+			query = query.Where(
+				fmt.Sprintf("(%s) %s (?, ?, ?)", keyColumns, comparison),
+				value, cursor.CreatedAt, cursorID,
+			)
+		} else {
+			query = query.Where(
+				fmt.Sprintf("(%s) %s (?, ?)", keyColumns, comparison),
+				cursor.CreatedAt, cursorID,
+			)
+		}
+	}
+
+	if sortColumn != "" {
+		query = query.Order(fmt.Sprintf("%s %s", sortColumn, direction))
+	}
+	query = query.Order("products.created_at " + direction).Order("products.id " + direction)
+
+	// Fetch one extra row to find out whether there is a next page
+	limit := utils.PageSize(first)
+	var products []models.Product
+	if err := inventory.PreloadProduct(query).Limit(limit + 1).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	hasNextPage := len(products) > limit
+	if hasNextPage {
+		products = products[:limit]
+	}
+
+	edges := make([]*model.ProductEdge, len(products))
+	nodes := make([]*model.Product, len(products))
+	for i, product := range products {
+		nodes[i] = product.ToGraphQL()
+		edges[i] = &model.ProductEdge{
+			Cursor: utils.EncodeCursor(productCursor(product, order.Field)),
+			Node:   nodes[i],
+		}
+	}
+
+	if err := currencies.ConvertProducts(nodes, currency); err != nil {
+		return nil, err
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     hasNextPage,
+		HasPreviousPage: after != nil && *after != "",
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.ProductConnection{
+		Edges:      edges,
+		PageInfo:   pageInfo,
+		TotalCount: int32(totalCount),
+	}, nil
+}
+
+func applyProductFilter(query *gorm.DB, filter *model.ProductFilter) (*gorm.DB, error) {
+	if filter == nil {
+		return query, nil
+	}
+
+	if filter.Search != nil && *filter.Search != "" {
+		var err error
+		query, err = searchCondition(query, *filter.Search)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(filter.CategoryIds) > 0 {
+		catUUIDs := make([]uuid.UUID, len(filter.CategoryIds))
+		for i, categoryID := range filter.CategoryIds {
+			catUUID, err := uuid.FromString(categoryID)
+			if err != nil {
+				return nil, err
+			}
+			catUUIDs[i] = catUUID
+		}
+
+		// Subquery instead of a join so products in several categories aren't duplicated
+		query = query.Where(
+			"products.id IN (SELECT product_id FROM category_products WHERE category_id IN ?)",
+			catUUIDs,
+		)
+	}
+
+	// Price bounds compare catalogue prices, so they only match products whose
+	// base price is in the bound's currency
+	if filter.MinPrice != nil && filter.MaxPrice != nil && filter.MinPrice.Currency != filter.MaxPrice.Currency {
+		return nil, ErrPriceCurrencyMismatch
+	}
+	if filter.MinPrice != nil {
+		query = query.Where("products.price_currency = ? AND products.price_amount >= ?",
+			filter.MinPrice.Currency, filter.MinPrice.Amount)
+	}
+
+	if filter.MaxPrice != nil {
+		query = query.Where("products.price_currency = ? AND products.price_amount <= ?",
+			filter.MaxPrice.Currency, filter.MaxPrice.Amount)
+	}
+
+	if filter.InStockOnly != nil && *filter.InStockOnly {
+		query = query.Where("products.stock > 0")
+	}
+
+	return query, nil
+}
+
+// priceCurrency is the currency of the filter's price bounds, or the default
+// currency without them
+func priceCurrency(filter *model.ProductFilter) string {
+	switch {
+	case filter != nil && filter.MinPrice != nil:
+		return filter.MinPrice.Currency
+	case filter != nil && filter.MaxPrice != nil:
+		return filter.MaxPrice.Currency
+	}
+	return model.DefaultCurrency()
+}
+
+// cursorValue checks that a cursor's sort value has the type of the field
+// it was sorted on, so a tampered cursor is refused rather than compared
+// against the wrong kind of column
+func cursorValue(value interface{}, field model.ProductOrderField) (interface{}, error) {
+	switch field {
+	case model.ProductOrderFieldPrice, model.ProductOrderFieldStock:
+		// JSON decodes every number as float64; price and stock are integers
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) || math.Abs(number) > 1<<53 {
+			return nil, utils.ErrInvalidCursor
+		}
+		return int64(number), nil
+	case model.ProductOrderFieldName:
+		name, ok := value.(string)
+		if !ok {
+			return nil, utils.ErrInvalidCursor
+		}
+		return name, nil
+	}
+	return nil, utils.ErrInvalidCursor
+}
+
+func productCursor(product models.Product, field model.ProductOrderField) utils.Cursor {
+	cursor := utils.Cursor{
+		CreatedAt: product.CreatedAt,
+		ID:        product.ID.String(),
+	}
+
+	switch field {
+	case model.ProductOrderFieldPrice:
+		cursor.Value = product.Price.Amount
+	case model.ProductOrderFieldName:
+		cursor.Value = product.Name
+	case model.ProductOrderFieldStock:
+		cursor.Value = product.Stock
+	}
+
+	return cursor
+}
+
+// GetCategoryAveragePrice averages the prices of the category's products in
+// the default currency, rounded to the nearest minor unit.
+func GetCategoryAveragePrice(categoryID string) (*model.Money, error) {
 	catUUID, err := uuid.FromString(categoryID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	var avgPrice float64
-	err = utils.DB.Model(&models.Product{}).
+	currency := model.DefaultCurrency()
+	var avgPrice int64
+	err = inventory.ListedProducts(utils.DB.Model(&models.Product{})).
 		Joins("JOIN category_products cp ON cp.product_id = products.id").
-		Where("cp.category_id = ?", catUUID).
-		Select("AVG(price)").
+		Where("cp.category_id = ? AND products.price_currency = ?", catUUID, currency).
+		Select("COALESCE(ROUND(AVG(price_amount)), 0)::bigint").
 		Row().
 		Scan(&avgPrice)
 
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return avgPrice, nil
+	avg := model.NewMoney(avgPrice, currency)
+	return &avg, nil
 }
 
 // implement this UpdateProduct(id, input)
-func UpdateProduct(id string, input model.ProductInput) (*model.Product, error) {
+func UpdateProduct(id string, input model.ProductInput, actorID string) (*model.Product, error) {
 	productUUID, err := uuid.FromString(id)
 	if err != nil {
 		return nil, err
 	}
-	var product models.Product
-	if err := utils.DB.First(&product, "id = ?", productUUID).Error; err != nil {
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	locked, err := inventory.LockProducts(tx, []uuid.UUID{productUUID})
+	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
+	product := locked[productUUID]
+	if product.DeletedAt != nil {
+		tx.Rollback()
+		return nil, inventory.ErrProductNotFound
+	}
+
 	product.Name = input.Name
 	if input.Description != nil {
 		product.Description = *input.Description
 	}
 	product.Price = input.Price
-	product.Stock = int(input.Stock)
-	if err := utils.DB.Save(&product).Error; err != nil {
+	if input.Weight != nil {
+		product.Weight = int(*input.Weight)
+	}
+	if err := tx.Model(&product).Select("name", "description", "price_amount", "price_currency", "weight").Updates(&product).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var variantCount int64
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&variantCount).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Stock changes are recorded in the ledger rather than overwritten. The
+	// stock of a product with variants is the sum of theirs and is changed
+	// per variant, so the input's stock is ignored for it.
+	if delta := int(input.Stock) - product.Stock; delta != 0 && variantCount == 0 {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID: product.ID,
+			Delta:     delta,
+			Reason:    models.InventoryReasonManualAdjustment,
+			ActorID:   &actorUUID,
+			Note:      "Product update",
+		}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		product.Stock = int(input.Stock)
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
 	return product.ToGraphQL(), nil
 }
 
-// implement this DeleteProduct(id)
+// DeleteProduct takes a product off sale. Its row stays, because the stock
+// ledger and past orders refer to it, but it is no longer listed, sold or
+// editable, and it is taken out of every cart.
 func DeleteProduct(id string) (bool, error) {
 	productUUID, err := uuid.FromString(id)
 	if err != nil {
 		return false, err
 	}
-	var product models.Product
-	if err := utils.DB.First(&product, "id = ?", productUUID).Error; err != nil {
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	locked, err := inventory.LockProducts(tx, []uuid.UUID{productUUID})
+	if err != nil {
+		tx.Rollback()
 		return false, err
 	}
-	if err := utils.DB.Delete(&product).Error; err != nil {
+	if locked[productUUID].DeletedAt != nil {
+		tx.Rollback()
+		return false, inventory.ErrProductNotFound
+	}
+
+	if err := tx.Model(&models.Product{}).Where("id = ?", productUUID).Update("deleted_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Where("product_id = ?", productUUID).Delete(&models.CartItem{}).Error; err != nil {
+		tx.Rollback()
 		return false, err
 	}
-	return true, nil
 
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // implement this GetProduct(id)
-func GetProductByID(id string) (*model.Product, error) {
+func GetProductByID(id string, currency string) (*model.Product, error) {
 	productUUID, err := uuid.FromString(id)
 	if err != nil {
 		return nil, err
 	}
 	var product models.Product
-	if err := utils.DB.Preload("Categories").First(&product, "id = ?", productUUID).Error; err != nil {
+	if err := inventory.ListedProducts(inventory.PreloadProduct(utils.DB)).First(&product, "id = ?", productUUID).Error; err != nil {
 		return nil, err
 	}
-	return product.ToGraphQL(), nil
+
+	result := product.ToGraphQL()
+	if err := currencies.ConvertProducts([]*model.Product{result}, currency); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -0,0 +1,136 @@
+package products
+
+import (
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCursorValue(t *testing.T) {
+	valid := []struct {
+		field model.ProductOrderField
+		value interface{}
+		want  interface{}
+	}{
+		{model.ProductOrderFieldPrice, float64(1999), int64(1999)},
+		{model.ProductOrderFieldStock, float64(0), int64(0)},
+		{model.ProductOrderFieldName, "Mug", "Mug"},
+	}
+	for _, test := range valid {
+		got, err := cursorValue(test.value, test.field)
+		if err != nil || got != test.want {
+			t.Errorf("cursorValue(%v, %s) = %v, %v; want %v", test.value, test.field, got, err, test.want)
+		}
+	}
+
+	invalid := []struct {
+		field model.ProductOrderField
+		value interface{}
+	}{
+		{model.ProductOrderFieldPrice, 19.99},
+		{model.ProductOrderFieldPrice, "1999"},
+		{model.ProductOrderFieldPrice, nil},
+		{model.ProductOrderFieldStock, 1e300},
+		{model.ProductOrderFieldName, float64(3)},
+		{model.ProductOrderFieldName, map[string]interface{}{"x": 1}},
+	}
+	for _, test := range invalid {
+		if _, err := cursorValue(test.value, test.field); !errors.Is(err, utils.ErrInvalidCursor) {
+			t.Errorf("cursorValue(%v, %s) returned %v, want ErrInvalidCursor", test.value, test.field, err)
+		}
+	}
+}
+
+func TestPriceCurrency(t *testing.T) {
+	kes := model.NewMoney(100000, "KES")
+	usd := model.NewMoney(5000, "USD")
+
+	tests := []struct {
+		filter *model.ProductFilter
+		want   string
+	}{
+		{nil, model.DefaultCurrency()},
+		{&model.ProductFilter{}, model.DefaultCurrency()},
+		{&model.ProductFilter{MinPrice: &kes}, "KES"},
+		{&model.ProductFilter{MaxPrice: &usd}, "USD"},
+	}
+	for _, test := range tests {
+		if got := priceCurrency(test.filter); got != test.want {
+			t.Errorf("priceCurrency(%+v) = %s, want %s", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestApplyProductFilterRejectsMixedPriceCurrencies(t *testing.T) {
+	kes := model.NewMoney(100000, "KES")
+	usd := model.NewMoney(5000, "USD")
+
+	_, err := applyProductFilter(nil, &model.ProductFilter{MinPrice: &kes, MaxPrice: &usd})
+	if !errors.Is(err, ErrPriceCurrencyMismatch) {
+		t.Errorf("got %v, want ErrPriceCurrencyMismatch", err)
+	}
+}
+
+func TestDeleteProductKeepsHistory(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	product := models.Product{
+		Name:  "Deleted Product",
+		Price: model.NewMoney(1000, model.DefaultCurrency()),
+		SKU:   "TEST-" + uuid.NewV4().String(),
+		Stock: 5,
+	}
+	if err := utils.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Create(&models.InventoryMovement{
+		ProductID: product.ID,
+		Delta:     5,
+		Reason:    models.InventoryReasonReceipt,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	customer := utils.CreateTestCustomer(t)
+	cart := models.Cart{UserID: customer.ID}
+	if err := utils.DB.Create(&cart).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.DB.Create(&models.CartItem{CartID: cart.ID, ProductID: product.ID, Quantity: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DeleteProduct(product.ID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.Product
+	if err := utils.DB.First(&stored, "id = ?", product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.DeletedAt == nil {
+		t.Error("deleted_at is not set")
+	}
+
+	var movements, cartItems int64
+	utils.DB.Model(&models.InventoryMovement{}).Where("product_id = ?", product.ID).Count(&movements)
+	utils.DB.Model(&models.CartItem{}).Where("product_id = ?", product.ID).Count(&cartItems)
+	if movements != 1 {
+		t.Errorf("%d ledger entries left, want 1", movements)
+	}
+	if cartItems != 0 {
+		t.Errorf("%d cart items left, want 0", cartItems)
+	}
+
+	if _, err := GetProductByID(product.ID.String(), model.DefaultCurrency()); err == nil {
+		t.Error("deleted product is still returned")
+	}
+	if _, err := DeleteProduct(product.ID.String()); !errors.Is(err, inventory.ErrProductNotFound) {
+		t.Errorf("deleting again returned %v, want ErrProductNotFound", err)
+	}
+}
@@ -0,0 +1,191 @@
+package products
+
+import (
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"strings"
+	"unicode"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var ErrEmptySearch = errors.New("search query must contain a letter or digit")
+
+// Options for ts_headline: up to two fragments of the description with the
+// matched words wrapped in <mark>
+const snippetOptions = "StartSel=<mark>, StopSel=</mark>, MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// searchTerms splits a query into words and builds a tsquery that matches
+// products containing every word, the last ones as prefixes so results
+// update while the customer is still typing
+func searchTerms(query string) (tsQuery string, text string, err error) {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "", "", ErrEmptySearch
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = word + ":*"
+	}
+	return strings.Join(terms, " & "), strings.Join(words, " "), nil
+}
+
+// searchCondition matches products by full-text search over the weighted
+// name, SKU and description vector, or by trigram similarity of the name
+// to catch typos. Both use an index.
+func searchCondition(query *gorm.DB, search string) (*gorm.DB, error) {
+	tsQuery, text, err := searchTerms(search)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Where(
+		"(products.search_vector @@ to_tsquery('english', ?) OR products.name % ?)",
+		tsQuery, text,
+	), nil
+}
+
+type searchHit struct {
+	ID      uuid.UUID
+	Score   float64
+	Snippet string
+}
+
+// SearchProducts ranks products against the query. Full-text matches are
+// ranked by where the words appear (name and SKU above description); only
+// when there are none does it fall back to names that are spelled alike.
+func SearchProducts(search string, first *int32, after *string, currency string) (*model.ProductSearchConnection, error) {
+	tsQuery, text, err := searchTerms(search)
+	if err != nil {
+		return nil, err
+	}
+
+	fuzzy := false
+	match := inventory.ListedProducts(utils.DB.Model(&models.Product{})).
+		Where("products.search_vector @@ to_tsquery('english', ?)", tsQuery)
+
+	var totalCount int64
+	if err := match.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		return nil, err
+	}
+
+	// Normalisation 32 scales the rank into [0, 1)
+	score := gorm.Expr("ts_rank_cd(products.search_vector, to_tsquery('english', ?), 32)::float8", tsQuery)
+	if totalCount == 0 {
+		fuzzy = true
+		match = inventory.ListedProducts(utils.DB.Model(&models.Product{})).Where("products.name % ?", text)
+		if err := match.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+			return nil, err
+		}
+		score = gorm.Expr("similarity(products.name, ?)::float8", text)
+	}
+
+	if after != nil && *after != "" {
+		cursor, err := utils.DecodeCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+
+		cursorID, err := uuid.FromString(cursor.ID)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		cursorScore, ok := cursor.Value.(float64)
+		if !ok {
+			return nil, utils.ErrInvalidCursor
+		}
+
+		match = match.Where("(?, products.id) < (?, ?)", score, cursorScore, cursorID)
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	limit := utils.PageSize(first)
+	var hits []searchHit
+	if err := match.Select(
+		"products.id, ? AS score, ts_headline('english', COALESCE(NULLIF(products.description, ''), products.name), to_tsquery('english', ?), ?) AS snippet",
+		score, tsQuery, snippetOptions,
+	).
+		Order("score DESC").
+		Order("products.id DESC").
+		Limit(limit + 1).
+		Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	hasNextPage := len(hits) > limit
+	if hasNextPage {
+		hits = hits[:limit]
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+
+	var products []models.Product
+	if len(ids) > 0 {
+		if err := inventory.PreloadProduct(utils.DB).Where("id IN ?", ids).Find(&products).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uuid.UUID]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	edges := make([]*model.ProductSearchEdge, 0, len(hits))
+	nodes := make([]*model.Product, 0, len(hits))
+	for _, hit := range hits {
+		product, ok := byID[hit.ID]
+		if !ok {
+			// Deleted since the search ran
+			continue
+		}
+
+		node := product.ToGraphQL()
+		edge := &model.ProductSearchEdge{
+			Cursor: utils.EncodeCursor(utils.Cursor{
+				Value:     hit.Score,
+				CreatedAt: product.CreatedAt,
+				ID:        product.ID.String(),
+			}),
+			Node:  node,
+			Score: hit.Score,
+		}
+		if hit.Snippet != "" {
+			snippet := hit.Snippet
+			edge.Snippet = &snippet
+		}
+
+		edges = append(edges, edge)
+		nodes = append(nodes, node)
+	}
+
+	if err := currencies.ConvertProducts(nodes, currency); err != nil {
+		return nil, err
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     hasNextPage,
+		HasPreviousPage: after != nil && *after != "",
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.ProductSearchConnection{
+		Edges:      edges,
+		PageInfo:   pageInfo,
+		TotalCount: int32(totalCount),
+		Fuzzy:      fuzzy,
+	}, nil
+}
@@ -0,0 +1,424 @@
+package products
+
+import (
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"sort"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOptionNameRequired    = errors.New("option name is required")
+	ErrOptionValuesRequired  = errors.New("an option needs at least one value")
+	ErrDuplicateOption       = errors.New("product already has an option with this name")
+	ErrDuplicateOptionValue  = errors.New("option values must be unique")
+	ErrVariantsExist         = errors.New("options can't be added once a product has variants")
+	ErrNoOptions             = errors.New("add the product's options before its variants")
+	ErrInvalidVariantOptions = errors.New("a variant needs exactly one value for each of the product's options")
+	ErrDuplicateVariant      = errors.New("product already has a variant with these options")
+	ErrVariantNotFound       = errors.New("variant not found")
+	ErrVariantHasStock       = errors.New("variant still has stock")
+	ErrVariantOrdered        = errors.New("variant has been ordered and can't be deleted")
+)
+
+// AddProductOption adds a way the product varies, with its possible values
+func AddProductOption(productID string, input model.ProductOptionInput) (*model.Product, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, ErrOptionNameRequired
+	}
+	if len(input.Values) == 0 {
+		return nil, ErrOptionValuesRequired
+	}
+
+	option := models.ProductOption{
+		ProductID: productUUID,
+		Name:      name,
+	}
+	seen := make(map[string]bool, len(input.Values))
+	for i, value := range input.Values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[strings.ToLower(value)] {
+			return nil, ErrDuplicateOptionValue
+		}
+		seen[strings.ToLower(value)] = true
+		option.Values = append(option.Values, models.ProductOptionValue{
+			Value:    value,
+			Position: i,
+		})
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := inventory.LockProducts(tx, []uuid.UUID{productUUID}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Existing variants would have no value for the new option
+	var variantCount int64
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productUUID).Count(&variantCount).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if variantCount > 0 {
+		tx.Rollback()
+		return nil, ErrVariantsExist
+	}
+
+	var existing []models.ProductOption
+	if err := tx.Where("product_id = ?", productUUID).Find(&existing).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, other := range existing {
+		if strings.EqualFold(other.Name, name) {
+			tx.Rollback()
+			return nil, ErrDuplicateOption
+		}
+	}
+	option.Position = len(existing)
+
+	if err := tx.Create(&option).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadProduct(productUUID)
+}
+
+// CreateProductVariant adds a variant with opening stock. A product's first
+// variant also takes over the stock already held for the product, since
+// from then on the product's stock is the sum of its variants'.
+func CreateProductVariant(productID string, input model.ProductVariantInput, actorID string) (*model.Product, error) {
+	productUUID, err := uuid.FromString(productID)
+	if err != nil {
+		return nil, err
+	}
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	locked, err := inventory.LockProducts(tx, []uuid.UUID{productUUID})
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	product := locked[productUUID]
+
+	values, err := selectOptionValues(tx, productUUID, input.Options)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var variantCount int64
+	if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productUUID).Count(&variantCount).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := checkDuplicateVariant(tx, productUUID, uuid.Nil, values); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	variant := models.ProductVariant{
+		ProductID:    productUUID,
+		SKU:          strings.TrimSpace(input.Sku),
+		OptionValues: values,
+	}
+	variant.SetPriceOverride(input.Price)
+	if variantCount == 0 {
+		variant.Stock = product.Stock
+	}
+
+	// The option values already exist; only link them
+	if err := tx.Omit("OptionValues.*").Create(&variant).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if input.Stock > 0 {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID: productUUID,
+			VariantID: &variant.ID,
+			Delta:     int(input.Stock),
+			Reason:    models.InventoryReasonReceipt,
+			ActorID:   &actorUUID,
+			Note:      "Opening stock",
+		}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadProduct(productUUID)
+}
+
+func UpdateProductVariant(id string, input model.ProductVariantInput, actorID string) (*model.Product, error) {
+	variantUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var variant models.ProductVariant
+	if err := utils.DB.First(&variant, "id = ?", variantUUID).Error; err != nil {
+		return nil, ErrVariantNotFound
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := inventory.LockProducts(tx, []uuid.UUID{variant.ProductID}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// Re-read now the product is locked, as the stock may have moved
+	if err := tx.First(&variant, "id = ?", variantUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrVariantNotFound
+	}
+
+	values, err := selectOptionValues(tx, variant.ProductID, input.Options)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := checkDuplicateVariant(tx, variant.ProductID, variant.ID, values); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Without a price the variant keeps the one it has
+	updates := map[string]interface{}{
+		"sku": strings.TrimSpace(input.Sku),
+	}
+	if input.Price != nil {
+		updates["price_amount"] = input.Price.Amount
+		updates["price_currency"] = input.Price.Currency
+	}
+	if err := tx.Model(&models.ProductVariant{}).Where("id = ?", variant.ID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := linkOptionValues(tx, variant.ID, values); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Stock changes are recorded in the ledger rather than overwritten
+	if delta := int(input.Stock) - variant.Stock; delta != 0 {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID: variant.ProductID,
+			VariantID: &variant.ID,
+			Delta:     delta,
+			Reason:    models.InventoryReasonManualAdjustment,
+			ActorID:   &actorUUID,
+			Note:      "Variant update",
+		}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadProduct(variant.ProductID)
+}
+
+// DeleteProductVariant removes a variant that has no stock and has never
+// been ordered. It is also taken out of any carts.
+func DeleteProductVariant(id string) (bool, error) {
+	variantUUID, err := uuid.FromString(id)
+	if err != nil {
+		return false, err
+	}
+
+	var variant models.ProductVariant
+	if err := utils.DB.First(&variant, "id = ?", variantUUID).Error; err != nil {
+		return false, ErrVariantNotFound
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := inventory.LockProducts(tx, []uuid.UUID{variant.ProductID}); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.First(&variant, "id = ?", variantUUID).Error; err != nil {
+		tx.Rollback()
+		return false, ErrVariantNotFound
+	}
+
+	if variant.Stock > 0 {
+		tx.Rollback()
+		return false, ErrVariantHasStock
+	}
+
+	var ordered int64
+	if err := tx.Model(&models.OrderItem{}).Where("variant_id = ?", variant.ID).Count(&ordered).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if ordered > 0 {
+		tx.Rollback()
+		return false, ErrVariantOrdered
+	}
+
+	if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.CartItem{}).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := linkOptionValues(tx, variant.ID, nil); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Delete(&variant).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// selectOptionValues finds the value picked for each of the product's
+// options. Every option must be given exactly once.
+func selectOptionValues(tx *gorm.DB, productID uuid.UUID, selected []*model.SelectedOptionInput) ([]models.ProductOptionValue, error) {
+	var options []models.ProductOption
+	if err := tx.Preload("Values").Where("product_id = ?", productID).Order("position").Find(&options).Error; err != nil {
+		return nil, err
+	}
+	if len(options) == 0 {
+		return nil, ErrNoOptions
+	}
+	if len(selected) != len(options) {
+		return nil, ErrInvalidVariantOptions
+	}
+
+	values := make([]models.ProductOptionValue, 0, len(options))
+	for _, option := range options {
+		var match *models.ProductOptionValue
+		for _, choice := range selected {
+			if !strings.EqualFold(strings.TrimSpace(choice.Name), option.Name) {
+				continue
+			}
+			for i := range option.Values {
+				if strings.EqualFold(strings.TrimSpace(choice.Value), option.Values[i].Value) {
+					match = &option.Values[i]
+				}
+			}
+		}
+		if match == nil {
+			return nil, ErrInvalidVariantOptions
+		}
+		values = append(values, *match)
+	}
+
+	return values, nil
+}
+
+// checkDuplicateVariant rejects a combination of values another of the
+// product's variants already has. exclude is the variant being updated.
+func checkDuplicateVariant(tx *gorm.DB, productID uuid.UUID, exclude uuid.UUID, values []models.ProductOptionValue) error {
+	var variants []models.ProductVariant
+	if err := tx.Preload("OptionValues").
+		Where("product_id = ? AND id <> ?", productID, exclude).
+		Find(&variants).Error; err != nil {
+		return err
+	}
+
+	key := optionValuesKey(values)
+	for _, variant := range variants {
+		if optionValuesKey(variant.OptionValues) == key {
+			return ErrDuplicateVariant
+		}
+	}
+	return nil
+}
+
+// linkOptionValues replaces the variant's option values. The join rows are
+// written directly because saving through the association would insert the
+// values again under new IDs.
+func linkOptionValues(tx *gorm.DB, variantID uuid.UUID, values []models.ProductOptionValue) error {
+	if err := tx.Exec("DELETE FROM product_variant_option_values WHERE product_variant_id = ?", variantID).Error; err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if err := tx.Exec("INSERT INTO product_variant_option_values (product_variant_id, product_option_value_id) VALUES (?, ?)",
+			variantID, value.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func optionValuesKey(values []models.ProductOptionValue) string {
+	ids := make([]string, len(values))
+	for i, value := range values {
+		ids[i] = value.ID.String()
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func loadProduct(productUUID uuid.UUID) (*model.Product, error) {
+	var product models.Product
+	if err := inventory.PreloadProduct(utils.DB).First(&product, "id = ?", productUUID).Error; err != nil {
+		return nil, err
+	}
+
+	return product.ToGraphQL(), nil
+}
@@ -0,0 +1,403 @@
+package promotions
+
+import (
+	"ecommerce-service/engine/categories"
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCouponNotFound       = errors.New("coupon code not found")
+	ErrCouponInactive       = errors.New("coupon is not active")
+	ErrCouponNotStarted     = errors.New("coupon is not valid yet")
+	ErrCouponExpired        = errors.New("coupon has expired")
+	ErrCouponUsageExceeded  = errors.New("coupon usage limit reached")
+	ErrCouponCustomerLimit  = errors.New("you have already used this coupon the maximum number of times")
+	ErrMinOrderValueNotMet  = errors.New("order does not meet the coupon's minimum value")
+	ErrCouponNotApplicable  = errors.New("coupon does not apply to any items in this order")
+	ErrInvalidPercentOff    = errors.New("percentOff must be between 1 and 100")
+	ErrInvalidAmountOff     = errors.New("amountOff must be greater than 0")
+	ErrMissingScopeTargets  = errors.New("category and product scoped promotions need at least one target")
+	ErrInvalidPromotionDate = errors.New("endsAt must be after startsAt")
+)
+
+func CreatePromotion(input model.PromotionInput) (*model.Promotion, error) {
+	promotion := models.Promotion{
+		Code:             strings.ToUpper(strings.TrimSpace(input.Code)),
+		Type:             models.PromotionType(input.Type),
+		Scope:            models.PromotionScope(input.Scope),
+		UsageLimit:       int32PtrToInt(input.UsageLimit),
+		PerCustomerLimit: int32PtrToInt(input.PerCustomerLimit),
+		StartsAt:         input.StartsAt,
+		EndsAt:           input.EndsAt,
+		Active:           true,
+	}
+
+	if input.Description != nil {
+		promotion.Description = *input.Description
+	}
+
+	switch promotion.Type {
+	case models.PromotionTypePercentage:
+		if input.PercentOff == nil || *input.PercentOff < 1 || *input.PercentOff > 100 {
+			return nil, ErrInvalidPercentOff
+		}
+		promotion.PercentOff = int(*input.PercentOff)
+	case models.PromotionTypeFixed:
+		if input.AmountOff == nil || input.AmountOff.Amount <= 0 {
+			return nil, ErrInvalidAmountOff
+		}
+		promotion.AmountOff = *input.AmountOff
+	}
+
+	if input.MinOrderValue != nil {
+		promotion.MinOrderValue = *input.MinOrderValue
+	}
+
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return nil, ErrInvalidPromotionDate
+	}
+
+	switch promotion.Scope {
+	case models.PromotionScopeCategory:
+		if len(input.CategoryIds) == 0 {
+			return nil, ErrMissingScopeTargets
+		}
+		for _, categoryID := range input.CategoryIds {
+			catUUID, err := uuid.FromString(categoryID)
+			if err != nil {
+				return nil, err
+			}
+
+			var category models.Category
+			if err := utils.DB.First(&category, "id = ?", catUUID).Error; err != nil {
+				return nil, err
+			}
+			promotion.Categories = append(promotion.Categories, category)
+		}
+	case models.PromotionScopeProduct:
+		if len(input.ProductIds) == 0 {
+			return nil, ErrMissingScopeTargets
+		}
+		for _, productID := range input.ProductIds {
+			productUUID, err := uuid.FromString(productID)
+			if err != nil {
+				return nil, err
+			}
+
+			var product models.Product
+			if err := utils.DB.First(&product, "id = ?", productUUID).Error; err != nil {
+				return nil, err
+			}
+			promotion.Products = append(promotion.Products, product)
+		}
+	}
+
+	if err := utils.DB.Create(&promotion).Error; err != nil {
+		return nil, err
+	}
+
+	return loadPromotion(promotion.ID)
+}
+
+func SetPromotionActive(id string, active bool) (*model.Promotion, error) {
+	promotionUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := utils.DB.Model(&models.Promotion{}).Where("id = ?", promotionUUID).Update("active", active)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCouponNotFound
+	}
+
+	return loadPromotion(promotionUUID)
+}
+
+func GetPromotions() ([]*model.Promotion, error) {
+	var promotions []models.Promotion
+	if err := utils.DB.Preload("Categories").Preload("Products").
+		Order("created_at DESC").
+		Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+
+	usage, err := usageCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Promotion, len(promotions))
+	for i, promotion := range promotions {
+		result[i] = promotion.ToGraphQL()
+		result[i].TimesUsed = int32(usage[promotion.ID])
+	}
+
+	return result, nil
+}
+
+// Apply validates a coupon code against an order and records the discount.
+// It must run inside the order transaction: it locks the promotion row so
+// usage limits hold under concurrent checkouts, and the redemption and
+// discount line roll back with the order. items must already be priced in
+// the order currency.
+//
+// Alongside the discount line it returns each item's share of the discount,
+// in the same order as items, so callers can work out per-item amounts
+// after discount.
+func Apply(tx *gorm.DB, code string, order *models.Order, items []models.OrderItem) (*models.OrderDiscount, []model.Money, error) {
+	var promotion models.Promotion
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).
+		First(&promotion).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrCouponNotFound
+		}
+		return nil, nil, err
+	}
+
+	if !promotion.Active {
+		return nil, nil, ErrCouponInactive
+	}
+
+	now := time.Now()
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return nil, nil, ErrCouponNotStarted
+	}
+	if promotion.EndsAt != nil && now.After(*promotion.EndsAt) {
+		return nil, nil, ErrCouponExpired
+	}
+
+	if promotion.UsageLimit != nil {
+		var used int64
+		if err := tx.Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ?", promotion.ID).
+			Count(&used).Error; err != nil {
+			return nil, nil, err
+		}
+		if used >= int64(*promotion.UsageLimit) {
+			return nil, nil, ErrCouponUsageExceeded
+		}
+	}
+
+	if promotion.PerCustomerLimit != nil {
+		var used int64
+		if err := tx.Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ? AND customer_id = ?", promotion.ID, order.CustomerID).
+			Count(&used).Error; err != nil {
+			return nil, nil, err
+		}
+		if used >= int64(*promotion.PerCustomerLimit) {
+			return nil, nil, ErrCouponCustomerLimit
+		}
+	}
+
+	if !promotion.MinOrderValue.IsZero() {
+		minOrderValue, _, err := currencies.Convert(tx, promotion.MinOrderValue, order.Subtotal.Currency)
+		if err != nil {
+			return nil, nil, err
+		}
+		if order.Subtotal.Amount < minOrderValue.Amount {
+			return nil, nil, ErrMinOrderValueNotMet
+		}
+	}
+
+	eligibleItems, eligible, err := eligibleSubtotal(tx, &promotion, items, order.Subtotal.Currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if eligible.IsZero() {
+		return nil, nil, ErrCouponNotApplicable
+	}
+
+	var amount model.Money
+	switch promotion.Type {
+	case models.PromotionTypePercentage:
+		amount = eligible.MulRat(big.NewRat(int64(promotion.PercentOff), 100))
+	case models.PromotionTypeFixed:
+		amount, _, err = currencies.Convert(tx, promotion.AmountOff, order.Subtotal.Currency)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Never discount more than the items the promotion covers
+	if amount.Amount > eligible.Amount {
+		amount = eligible
+	}
+
+	if err := tx.Create(&models.PromotionRedemption{
+		PromotionID: promotion.ID,
+		CustomerID:  order.CustomerID,
+		OrderID:     order.ID,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	discount := models.OrderDiscount{
+		OrderID:     order.ID,
+		PromotionID: promotion.ID,
+		Code:        promotion.Code,
+		Description: promotion.Description,
+		Amount:      amount,
+	}
+	if err := tx.Create(&discount).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &discount, allocate(amount, items, eligibleItems, eligible), nil
+}
+
+// Release gives back the coupon uses of a cancelled order, so they no longer
+// count towards the promotion's limits. The order keeps its discount line.
+func Release(tx *gorm.DB, orderID uuid.UUID) error {
+	return tx.Where("order_id = ?", orderID).Delete(&models.PromotionRedemption{}).Error
+}
+
+// allocate splits a discount across the eligible items in proportion to their
+// subtotals. The last eligible item absorbs the rounding remainder so the
+// shares always add up to the discount.
+func allocate(amount model.Money, items []models.OrderItem, eligibleItems map[uuid.UUID]bool, eligible model.Money) []model.Money {
+	shares := make([]model.Money, len(items))
+	last := -1
+	allocated := model.NewMoney(0, amount.Currency)
+	for i, item := range items {
+		shares[i] = model.NewMoney(0, amount.Currency)
+		if !eligibleItems[item.ProductID] {
+			continue
+		}
+
+		shares[i] = amount.MulRat(big.NewRat(item.SubTotal.Amount, eligible.Amount))
+		allocated.Amount += shares[i].Amount
+		last = i
+	}
+
+	if last >= 0 {
+		shares[last].Amount += amount.Amount - allocated.Amount
+	}
+
+	return shares
+}
+
+// eligibleSubtotal works out which products the promotion's scope covers and
+// sums their items
+func eligibleSubtotal(tx *gorm.DB, promotion *models.Promotion, items []models.OrderItem, currency string) (map[uuid.UUID]bool, model.Money, error) {
+	eligible := make(map[uuid.UUID]bool)
+
+	switch promotion.Scope {
+	case models.PromotionScopeOrder:
+		for _, item := range items {
+			eligible[item.ProductID] = true
+		}
+	case models.PromotionScopeProduct:
+		var productIDs []uuid.UUID
+		if err := tx.Table("promotion_products").
+			Where("promotion_id = ?", promotion.ID).
+			Pluck("product_id", &productIDs).Error; err != nil {
+			return nil, model.Money{}, err
+		}
+		for _, productID := range productIDs {
+			eligible[productID] = true
+		}
+	case models.PromotionScopeCategory:
+		productIDs := make([]uuid.UUID, len(items))
+		for i, item := range items {
+			productIDs[i] = item.ProductID
+		}
+
+		var categoryIDs []uuid.UUID
+		if err := tx.Table("promotion_categories").
+			Where("promotion_id = ?", promotion.ID).
+			Pluck("category_id", &categoryIDs).Error; err != nil {
+			return nil, model.Money{}, err
+		}
+
+		// A category covers everything below it, as when browsing it
+		var matched []uuid.UUID
+		if err := tx.Table("category_products").
+			Where("product_id IN ?", productIDs).
+			Where("category_id IN (?)", categories.SubtreeIDs(tx, categoryIDs...)).
+			Distinct().
+			Pluck("product_id", &matched).Error; err != nil {
+			return nil, model.Money{}, err
+		}
+		for _, productID := range matched {
+			eligible[productID] = true
+		}
+	}
+
+	total := model.NewMoney(0, currency)
+	for _, item := range items {
+		if !eligible[item.ProductID] {
+			continue
+		}
+
+		var err error
+		total, err = total.Add(item.SubTotal)
+		if err != nil {
+			return nil, model.Money{}, err
+		}
+	}
+
+	return eligible, total, nil
+}
+
+func loadPromotion(promotionUUID uuid.UUID) (*model.Promotion, error) {
+	var promotion models.Promotion
+	if err := utils.DB.Preload("Categories").Preload("Products").
+		First(&promotion, "id = ?", promotionUUID).Error; err != nil {
+		return nil, err
+	}
+
+	var used int64
+	if err := utils.DB.Model(&models.PromotionRedemption{}).
+		Where("promotion_id = ?", promotionUUID).
+		Count(&used).Error; err != nil {
+		return nil, err
+	}
+
+	result := promotion.ToGraphQL()
+	result.TimesUsed = int32(used)
+	return result, nil
+}
+
+func usageCounts() (map[uuid.UUID]int, error) {
+	var rows []struct {
+		PromotionID uuid.UUID
+		Count       int
+	}
+	if err := utils.DB.Model(&models.PromotionRedemption{}).
+		Select("promotion_id, COUNT(*) AS count").
+		Group("promotion_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.PromotionID] = row.Count
+	}
+
+	return counts, nil
+}
+
+func int32PtrToInt(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
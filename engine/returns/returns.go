@@ -0,0 +1,435 @@
+package returns
+
+import (
+	"context"
+	"ecommerce-service/engine/inventory"
+	"ecommerce-service/engine/payments"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReturnNotFound        = errors.New("return request not found")
+	ErrOrderNotReturnable    = errors.New("only completed orders can be returned")
+	ErrNoReturnItems         = errors.New("a return needs at least one item")
+	ErrReturnReasonRequired  = errors.New("a reason for the return is required")
+	ErrOrderItemNotFound     = errors.New("item is not part of this order")
+	ErrInvalidReturnQuantity = errors.New("return quantity must be positive and no more than the quantity not already returned")
+	ErrReturnAlreadyReviewed = errors.New("return request has already been reviewed")
+	ErrReturnNotApproved     = errors.New("only approved returns can be received")
+	ErrRefundInProgress      = errors.New("the refund for this return is already in progress")
+	ErrInvalidRefundAmount   = errors.New("refund amount must be in the order currency and no more than was paid for the returned items")
+)
+
+// RequestReturn opens a return for some of the items of one of the
+// customer's completed orders
+func RequestReturn(userID string, input model.ReturnRequestInput) (*model.ReturnRequest, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orderUUID, err := uuid.FromString(input.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		return nil, ErrReturnReasonRequired
+	}
+	if len(input.Items) == 0 {
+		return nil, ErrNoReturnItems
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the order so two requests for the same items can't both pass the
+	// quantity check
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items").
+		First(&order, "id = ?", orderUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if order.CustomerID != userUUID {
+		tx.Rollback()
+		return nil, errors.New("unauthorized access to order")
+	}
+	if order.Status != models.OrderStatusCompleted {
+		tx.Rollback()
+		return nil, ErrOrderNotReturnable
+	}
+
+	returnable, err := returnableQuantities(tx, &order)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Total quantity requested per order item, so an item listed twice is
+	// checked once
+	requested := make(map[uuid.UUID]int)
+	itemIDs := make([]uuid.UUID, 0, len(input.Items))
+	for _, itemInput := range input.Items {
+		orderItemUUID, err := uuid.FromString(itemInput.OrderItemID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if _, ok := returnable[orderItemUUID]; !ok {
+			tx.Rollback()
+			return nil, ErrOrderItemNotFound
+		}
+		if itemInput.Quantity <= 0 {
+			tx.Rollback()
+			return nil, ErrInvalidReturnQuantity
+		}
+		if _, ok := requested[orderItemUUID]; !ok {
+			itemIDs = append(itemIDs, orderItemUUID)
+		}
+		requested[orderItemUUID] += int(itemInput.Quantity)
+	}
+
+	request := models.ReturnRequest{
+		OrderID:      order.ID,
+		CustomerID:   userUUID,
+		Status:       models.ReturnStatusRequested,
+		Reason:       reason,
+		RefundAmount: model.NewMoney(0, order.Total.Currency),
+	}
+	for _, orderItemUUID := range itemIDs {
+		if requested[orderItemUUID] > returnable[orderItemUUID] {
+			tx.Rollback()
+			return nil, ErrInvalidReturnQuantity
+		}
+		request.Items = append(request.Items, models.ReturnItem{
+			OrderItemID: orderItemUUID,
+			Quantity:    requested[orderItemUUID],
+		})
+	}
+
+	if err := tx.Create(&request).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return loadReturnRequest(request.ID)
+}
+
+// ApproveReturn accepts a requested return; the customer can then send the
+// goods back
+func ApproveReturn(id string, note *string, actorID string) (*model.ReturnRequest, error) {
+	return review(id, models.ReturnStatusApproved, note, actorID)
+}
+
+func RejectReturn(id string, note *string, actorID string) (*model.ReturnRequest, error) {
+	return review(id, models.ReturnStatusRejected, note, actorID)
+}
+
+// ReceiveReturn records that the goods of an approved return have arrived.
+// They are put back in stock and refundAmount, or what the customer paid for
+// the returned items if it is nil, is refunded to the order's payment.
+//
+// The return stays RECEIVED until the refund succeeds. If the refund fails,
+// calling this again retries it. Orders without a captured payment are also
+// left RECEIVED, to be refunded by hand.
+func ReceiveReturn(ctx context.Context, id string, refundAmount *model.Money, actorID string) (*model.ReturnRequest, error) {
+	requestUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var request models.ReturnRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Items.OrderItem").
+		Preload("PaymentRefund").
+		First(&request, "id = ?", requestUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrReturnNotFound
+	}
+
+	switch {
+	case request.Status == models.ReturnStatusApproved:
+		if err := restock(tx, &request, actorUUID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	case request.Status == models.ReturnStatusReceived && refundable(&request):
+		// Retrying a refund that failed
+	case request.Status == models.ReturnStatusReceived:
+		tx.Rollback()
+		return nil, ErrRefundInProgress
+	default:
+		tx.Rollback()
+		return nil, ErrReturnNotApproved
+	}
+
+	paid, err := paidForItems(&request)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	amount := paid
+	if refundAmount != nil {
+		amount = *refundAmount
+	}
+	if amount.Currency != paid.Currency || amount.Amount < 0 || amount.Amount > paid.Amount {
+		tx.Rollback()
+		return nil, ErrInvalidRefundAmount
+	}
+
+	request.RefundAmount = amount
+	if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", request.ID).Updates(map[string]interface{}{
+		"refund_amount_amount":   amount.Amount,
+		"refund_amount_currency": amount.Currency,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Nothing to refund, e.g. the goods came back damaged
+	if amount.IsZero() {
+		if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", request.ID).Update("status", models.ReturnStatusRefunded).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	if amount.IsZero() {
+		return loadReturnRequest(request.ID)
+	}
+
+	var payment models.Payment
+	err = utils.DB.Where("order_id = ? AND status IN ?", request.OrderID, []models.PaymentStatus{
+		models.PaymentStatusCaptured,
+		models.PaymentStatusPartiallyRefunded,
+	}).
+		Order("captured_at DESC").
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return loadReturnRequest(request.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The return is claimed in the transaction that records the refund, so
+	// of two attempts at once only one reaches the provider. It is marked
+	// REFUNDED by the payments package once the refund succeeds, which for
+	// some providers is only when their webhook arrives.
+	claim := func(tx *gorm.DB, refund *models.PaymentRefund) error {
+		var claimed models.ReturnRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("PaymentRefund").
+			First(&claimed, "id = ?", request.ID).Error; err != nil {
+			return err
+		}
+		if claimed.Status != models.ReturnStatusReceived || !refundable(&claimed) {
+			return ErrRefundInProgress
+		}
+		return tx.Model(&models.ReturnRequest{}).Where("id = ?", request.ID).Update("payment_refund_id", refund.ID).Error
+	}
+
+	reason := fmt.Sprintf("Return #%s: %s", request.ID.String()[:8], request.Reason)
+	if _, err := payments.RefundWithHook(ctx, payment.ID, &amount, reason, &actorUUID, claim); err != nil {
+		return nil, err
+	}
+
+	return loadReturnRequest(request.ID)
+}
+
+// refundable reports whether a received return can be refunded: it has no
+// refund yet, or its last one failed
+func refundable(request *models.ReturnRequest) bool {
+	return request.PaymentRefund == nil || request.PaymentRefund.Status == models.RefundStatusFailed
+}
+
+func GetReturnRequests(status *model.ReturnStatus) ([]*model.ReturnRequest, error) {
+	query := preloadReturnRequest(utils.DB).Order("created_at DESC")
+	if status != nil {
+		query = query.Where("status = ?", models.ReturnStatus(*status))
+	}
+
+	var requests []models.ReturnRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.ReturnRequest, len(requests))
+	for i, request := range requests {
+		result[i] = request.ToGraphQL()
+	}
+
+	return result, nil
+}
+
+func review(id string, status models.ReturnStatus, note *string, actorID string) (*model.ReturnRequest, error) {
+	requestUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	actorUUID, err := uuid.FromString(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"status":         status,
+		"reviewed_by_id": actorUUID,
+		"reviewed_at":    time.Now(),
+	}
+	if note != nil {
+		updates["admin_note"] = strings.TrimSpace(*note)
+	}
+
+	// Conditional on the current status so two admins can't both review it
+	result := utils.DB.Model(&models.ReturnRequest{}).
+		Where("id = ? AND status = ?", requestUUID, models.ReturnStatusRequested).
+		Updates(updates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := utils.DB.Model(&models.ReturnRequest{}).Where("id = ?", requestUUID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrReturnNotFound
+		}
+		return nil, ErrReturnAlreadyReviewed
+	}
+
+	return loadReturnRequest(requestUUID)
+}
+
+// restock puts the returned items back in stock and marks the return
+// RECEIVED
+func restock(tx *gorm.DB, request *models.ReturnRequest, actorID uuid.UUID) error {
+	productIDs := make([]uuid.UUID, len(request.Items))
+	for i, item := range request.Items {
+		productIDs[i] = item.OrderItem.ProductID
+	}
+	if _, err := inventory.LockProducts(tx, productIDs); err != nil {
+		return err
+	}
+
+	for _, item := range request.Items {
+		if err := inventory.ApplyMovement(tx, &models.InventoryMovement{
+			ProductID:   item.OrderItem.ProductID,
+			VariantID:   item.OrderItem.VariantID,
+			Delta:       item.Quantity,
+			Reason:      models.InventoryReasonReturn,
+			ReferenceID: &request.ID,
+			ActorID:     &actorID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	request.Status = models.ReturnStatusReceived
+	request.ReceivedAt = &now
+	return tx.Model(&models.ReturnRequest{}).Where("id = ?", request.ID).Updates(map[string]interface{}{
+		"status":      request.Status,
+		"received_at": request.ReceivedAt,
+	}).Error
+}
+
+// returnableQuantities is how many units of each of the order's items are
+// not already part of a return that wasn't rejected
+func returnableQuantities(tx *gorm.DB, order *models.Order) (map[uuid.UUID]int, error) {
+	returnable := make(map[uuid.UUID]int, len(order.Items))
+	for _, item := range order.Items {
+		returnable[item.ID] = item.Quantity
+	}
+
+	var returned []struct {
+		OrderItemID uuid.UUID
+		Quantity    int
+	}
+	if err := tx.Model(&models.ReturnItem{}).
+		Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+		Where("return_requests.order_id = ? AND return_requests.status <> ?", order.ID, models.ReturnStatusRejected).
+		Group("return_items.order_item_id").
+		Scan(&returned).Error; err != nil {
+		return nil, err
+	}
+
+	for _, item := range returned {
+		returnable[item.OrderItemID] -= item.Quantity
+	}
+
+	return returnable, nil
+}
+
+// paidForItems is what the customer paid for the returned units
+func paidForItems(request *models.ReturnRequest) (model.Money, error) {
+	total := model.Money{}
+	for _, item := range request.Items {
+		paid, err := item.OrderItem.PaidAmount(item.Quantity)
+		if err != nil {
+			return model.Money{}, err
+		}
+		total, err = total.Add(paid)
+		if err != nil {
+			return model.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+func preloadReturnRequest(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items.OrderItem.Product").
+		Preload("Items.OrderItem.Variant.OptionValues.Option").
+		Preload("PaymentRefund")
+}
+
+func loadReturnRequest(id uuid.UUID) (*model.ReturnRequest, error) {
+	var request models.ReturnRequest
+	if err := preloadReturnRequest(utils.DB).First(&request, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return request.ToGraphQL(), nil
+}
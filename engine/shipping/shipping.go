@@ -0,0 +1,242 @@
+package shipping
+
+import (
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrShippingMethodNotFound = errors.New("shipping method not found")
+	ErrNoShippingMethod       = errors.New("no shipping method available for this country")
+	ErrMethodNotForCountry    = errors.New("shipping method does not deliver to this country")
+	ErrNoApplicableTier       = errors.New("shipping method has no rate for this order")
+	ErrInvalidCountry         = errors.New("country must be an ISO 3166 alpha-2 code")
+	ErrMissingFlatRate        = errors.New("flat rate methods need a flatRate")
+	ErrMissingTiers           = errors.New("tiered methods need tiers, including one starting at zero")
+	ErrNegativeCost           = errors.New("shipping costs cannot be negative")
+)
+
+// Parcel is what a shipping rate is worked out from
+type Parcel struct {
+	Weight int         // Grams
+	Value  model.Money // Goods value after discounts, in the order currency
+}
+
+func CreateShippingMethod(input model.ShippingMethodInput) (*model.ShippingMethod, error) {
+	country := utils.NormalizeCountry(input.Country)
+	if len(country) != 2 {
+		return nil, ErrInvalidCountry
+	}
+
+	method := models.ShippingMethod{
+		Name:          strings.TrimSpace(input.Name),
+		Country:       country,
+		Type:          models.ShippingRateType(input.Type),
+		EstimatedDays: int32PtrToInt(input.EstimatedDays),
+		Active:        true,
+	}
+
+	switch method.Type {
+	case models.ShippingRateFlat:
+		if input.FlatRate == nil {
+			return nil, ErrMissingFlatRate
+		}
+		if input.FlatRate.Amount < 0 {
+			return nil, ErrNegativeCost
+		}
+		method.FlatRate = *input.FlatRate
+	case models.ShippingRateWeightTiered, models.ShippingRatePriceTiered:
+		startsAtZero := false
+		for _, tierInput := range input.Tiers {
+			if tierInput.Cost.Amount < 0 {
+				return nil, ErrNegativeCost
+			}
+
+			tier := models.ShippingRateTier{Cost: tierInput.Cost}
+			if method.Type == models.ShippingRateWeightTiered {
+				if tierInput.MinWeight == nil || *tierInput.MinWeight < 0 {
+					return nil, ErrMissingTiers
+				}
+				tier.MinWeight = int(*tierInput.MinWeight)
+				startsAtZero = startsAtZero || tier.MinWeight == 0
+			} else {
+				if tierInput.MinOrderValue == nil || tierInput.MinOrderValue.Amount < 0 {
+					return nil, ErrMissingTiers
+				}
+				tier.MinOrderValue = *tierInput.MinOrderValue
+				startsAtZero = startsAtZero || tier.MinOrderValue.IsZero()
+			}
+			method.Tiers = append(method.Tiers, tier)
+		}
+
+		// Without a tier from zero some orders could never be quoted
+		if !startsAtZero {
+			return nil, ErrMissingTiers
+		}
+	}
+
+	if err := utils.DB.Create(&method).Error; err != nil {
+		return nil, err
+	}
+
+	return loadShippingMethod(method.ID)
+}
+
+func SetShippingMethodActive(id string, active bool) (*model.ShippingMethod, error) {
+	methodUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := utils.DB.Model(&models.ShippingMethod{}).Where("id = ?", methodUUID).Update("active", active)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrShippingMethodNotFound
+	}
+
+	return loadShippingMethod(methodUUID)
+}
+
+// GetShippingMethods lists the active methods that deliver to country
+func GetShippingMethods(country string) ([]*model.ShippingMethod, error) {
+	var methods []models.ShippingMethod
+	if err := utils.DB.Preload("Tiers").
+		Where("country = ? AND active", utils.NormalizeCountry(country)).
+		Order("name").
+		Find(&methods).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.ShippingMethod, len(methods))
+	for i, method := range methods {
+		result[i] = method.ToGraphQL()
+	}
+
+	return result, nil
+}
+
+// ForOrder picks the shipping method for an order to country and quotes it
+// in the parcel's currency. Without a methodID the cheapest active method
+// for the country is used.
+func ForOrder(tx *gorm.DB, methodID *string, country string, parcel Parcel) (*models.ShippingMethod, model.Money, error) {
+	if methodID != nil && *methodID != "" {
+		methodUUID, err := uuid.FromString(*methodID)
+		if err != nil {
+			return nil, model.Money{}, err
+		}
+
+		var method models.ShippingMethod
+		if err := tx.Preload("Tiers").Where("id = ? AND active", methodUUID).First(&method).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, model.Money{}, ErrShippingMethodNotFound
+			}
+			return nil, model.Money{}, err
+		}
+		if method.Country != country {
+			return nil, model.Money{}, ErrMethodNotForCountry
+		}
+
+		cost, err := Quote(tx, &method, parcel)
+		if err != nil {
+			return nil, model.Money{}, err
+		}
+		return &method, cost, nil
+	}
+
+	var methods []models.ShippingMethod
+	if err := tx.Preload("Tiers").Where("country = ? AND active", country).Find(&methods).Error; err != nil {
+		return nil, model.Money{}, err
+	}
+
+	var cheapest *models.ShippingMethod
+	var cheapestCost model.Money
+	for i := range methods {
+		cost, err := Quote(tx, &methods[i], parcel)
+		if errors.Is(err, ErrNoApplicableTier) {
+			continue
+		}
+		if err != nil {
+			return nil, model.Money{}, err
+		}
+		if cheapest == nil || cost.Amount < cheapestCost.Amount {
+			cheapest, cheapestCost = &methods[i], cost
+		}
+	}
+
+	if cheapest == nil {
+		return nil, model.Money{}, ErrNoShippingMethod
+	}
+	return cheapest, cheapestCost, nil
+}
+
+// Quote works out what a method charges for a parcel, in the parcel's
+// currency. method.Tiers must be loaded.
+func Quote(db *gorm.DB, method *models.ShippingMethod, parcel Parcel) (model.Money, error) {
+	currency := parcel.Value.Currency
+
+	var cost model.Money
+	switch method.Type {
+	case models.ShippingRateFlat:
+		cost = method.FlatRate
+	case models.ShippingRateWeightTiered:
+		// The tier with the highest threshold the parcel reaches applies
+		var best *models.ShippingRateTier
+		for i, tier := range method.Tiers {
+			if parcel.Weight >= tier.MinWeight && (best == nil || tier.MinWeight > best.MinWeight) {
+				best = &method.Tiers[i]
+			}
+		}
+		if best == nil {
+			return model.Money{}, ErrNoApplicableTier
+		}
+		cost = best.Cost
+	case models.ShippingRatePriceTiered:
+		var best *models.ShippingRateTier
+		var bestMinimum model.Money
+		for i, tier := range method.Tiers {
+			minimum, _, err := currencies.Convert(db, tier.MinOrderValue, currency)
+			if err != nil {
+				return model.Money{}, err
+			}
+			if parcel.Value.Amount >= minimum.Amount && (best == nil || minimum.Amount > bestMinimum.Amount) {
+				best, bestMinimum = &method.Tiers[i], minimum
+			}
+		}
+		if best == nil {
+			return model.Money{}, ErrNoApplicableTier
+		}
+		cost = best.Cost
+	}
+
+	converted, _, err := currencies.Convert(db, cost, currency)
+	if err != nil {
+		return model.Money{}, err
+	}
+	return converted, nil
+}
+
+func loadShippingMethod(id uuid.UUID) (*model.ShippingMethod, error) {
+	var method models.ShippingMethod
+	if err := utils.DB.Preload("Tiers").First(&method, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	return method.ToGraphQL(), nil
+}
+
+func int32PtrToInt(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
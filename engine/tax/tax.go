@@ -0,0 +1,223 @@
+package tax
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCountry  = errors.New("country must be an ISO 3166 alpha-2 code")
+	ErrInvalidTaxRate  = errors.New("tax rate must be a decimal percentage between 0 and 100")
+	ErrTaxRateNotFound = errors.New("tax rate not found")
+)
+
+// Calculator resolves the tax rate for each product in an order placed from
+// one country
+type Calculator struct {
+	countryRate  *models.TaxRate
+	categoryRate map[uuid.UUID]*models.TaxRate
+	categories   map[uuid.UUID][]uuid.UUID // Product ID to category IDs
+}
+
+// NewCalculator loads the rates for country and the categories of the given
+// products. Pass the order transaction so the rates read are consistent
+// with the rest of the order.
+func NewCalculator(db *gorm.DB, country string, productIDs []uuid.UUID) (*Calculator, error) {
+	calculator := &Calculator{
+		categoryRate: make(map[uuid.UUID]*models.TaxRate),
+		categories:   make(map[uuid.UUID][]uuid.UUID),
+	}
+
+	var rates []models.TaxRate
+	if err := db.Where("country = ?", utils.NormalizeCountry(country)).Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return calculator, nil
+	}
+
+	for i := range rates {
+		if rates[i].CategoryID == nil {
+			calculator.countryRate = &rates[i]
+		} else {
+			calculator.categoryRate[*rates[i].CategoryID] = &rates[i]
+		}
+	}
+
+	if len(calculator.categoryRate) > 0 && len(productIDs) > 0 {
+		var links []struct {
+			ProductID  uuid.UUID
+			CategoryID uuid.UUID
+		}
+		if err := db.Table("category_products").
+			Select("product_id, category_id").
+			Where("product_id IN ?", productIDs).
+			Scan(&links).Error; err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			calculator.categories[link.ProductID] = append(calculator.categories[link.ProductID], link.CategoryID)
+		}
+	}
+
+	return calculator, nil
+}
+
+// RateFor returns the rate that applies to a product, or nil if the product
+// is untaxed. A category rate wins over the country rate; if the product is
+// in several categories with their own rates, the lowest one applies.
+func (c *Calculator) RateFor(productID uuid.UUID) (*models.TaxRate, error) {
+	var chosen *models.TaxRate
+	var chosenValue *big.Rat
+	for _, categoryID := range c.categories[productID] {
+		rate, ok := c.categoryRate[categoryID]
+		if !ok {
+			continue
+		}
+
+		value, err := parseRate(rate.Rate)
+		if err != nil {
+			return nil, err
+		}
+		if chosen == nil || value.Cmp(chosenValue) < 0 {
+			chosen, chosenValue = rate, value
+		}
+	}
+
+	if chosen != nil {
+		return chosen, nil
+	}
+	return c.countryRate, nil
+}
+
+// Calculate returns the tax on amount at rate. For tax-inclusive rates the
+// tax is the part of amount that is tax; otherwise it is added on top.
+func Calculate(rate *models.TaxRate, amount model.Money) (model.Money, error) {
+	if rate == nil {
+		return model.NewMoney(0, amount.Currency), nil
+	}
+
+	percent, err := parseRate(rate.Rate)
+	if err != nil {
+		return model.Money{}, err
+	}
+
+	// Exclusive: amount * r/100. Inclusive: amount * r/(100+r).
+	divisor := big.NewRat(100, 1)
+	if rate.PricesIncludeTax {
+		divisor.Add(divisor, percent)
+	}
+
+	return amount.MulRat(new(big.Rat).Quo(percent, divisor)), nil
+}
+
+func parseRate(rate string) (*big.Rat, error) {
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("corrupt tax rate %q", rate)
+	}
+	return value, nil
+}
+
+func SetTaxRate(input model.TaxRateInput) (*model.TaxRate, error) {
+	country := utils.NormalizeCountry(input.Country)
+	if len(country) != 2 {
+		return nil, ErrInvalidCountry
+	}
+
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(input.Rate))
+	if !ok || value.Sign() < 0 || value.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, ErrInvalidTaxRate
+	}
+
+	var categoryUUID *uuid.UUID
+	if input.CategoryID != nil {
+		parsed, err := uuid.FromString(*input.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+
+		var category models.Category
+		if err := utils.DB.First(&category, "id = ?", parsed).Error; err != nil {
+			return nil, err
+		}
+		categoryUUID = &parsed
+	}
+
+	// NULL category IDs never collide in a unique index, so look the
+	// existing rate up instead of relying on ON CONFLICT
+	query := utils.DB.Where("country = ?", country)
+	if categoryUUID != nil {
+		query = query.Where("category_id = ?", *categoryUUID)
+	} else {
+		query = query.Where("category_id IS NULL")
+	}
+
+	var taxRate models.TaxRate
+	if err := query.First(&taxRate).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	taxRate.Country = country
+	taxRate.CategoryID = categoryUUID
+	taxRate.Name = strings.TrimSpace(input.Name)
+	if taxRate.Name == "" {
+		taxRate.Name = "Tax"
+	}
+	taxRate.Rate = value.FloatString(4)
+	taxRate.PricesIncludeTax = input.PricesIncludeTax
+
+	if err := utils.DB.Save(&taxRate).Error; err != nil {
+		return nil, err
+	}
+
+	if err := utils.DB.Preload("Category").First(&taxRate, "id = ?", taxRate.ID).Error; err != nil {
+		return nil, err
+	}
+
+	return taxRate.ToGraphQL(), nil
+}
+
+func DeleteTaxRate(id string) (bool, error) {
+	rateUUID, err := uuid.FromString(id)
+	if err != nil {
+		return false, err
+	}
+
+	result := utils.DB.Delete(&models.TaxRate{}, "id = ?", rateUUID)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, ErrTaxRateNotFound
+	}
+
+	return true, nil
+}
+
+func GetTaxRates(country *string) ([]*model.TaxRate, error) {
+	query := utils.DB.Preload("Category").Order("country, category_id NULLS FIRST")
+	if country != nil && *country != "" {
+		query = query.Where("country = ?", utils.NormalizeCountry(*country))
+	}
+
+	var rates []models.TaxRate
+	if err := query.Find(&rates).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.TaxRate, len(rates))
+	for i, rate := range rates {
+		result[i] = rate.ToGraphQL()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package users
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserDeleted      = errors.New("user has been deleted")
+	ErrUserNotSuspended = errors.New("user is not suspended")
+	ErrCannotManageSelf = errors.New("you cannot suspend or delete your own account")
+)
+
+// GetUsers lists users newest first. Deleted users are left out unless the
+// filter asks for them.
+func GetUsers(filter *model.UserFilter, first *int32, after *string) (*model.UserConnection, error) {
+	query := utils.DB.Model(&models.User{})
+
+	status := model.UserStatusActive
+	if filter != nil && filter.Status != nil {
+		status = *filter.Status
+	}
+	switch status {
+	case model.UserStatusDeleted:
+		query = query.Where("users.deleted_at IS NOT NULL")
+	case model.UserStatusSuspended:
+		query = query.Where("users.deleted_at IS NULL AND users.suspended_at IS NOT NULL")
+	default:
+		query = query.Where("users.deleted_at IS NULL")
+		// Without a status filter both active and suspended users are listed
+		if filter != nil && filter.Status != nil {
+			query = query.Where("users.suspended_at IS NULL")
+		}
+	}
+
+	if filter != nil {
+		if filter.Search != nil && strings.TrimSpace(*filter.Search) != "" {
+			pattern := "%" + escapeLike(strings.TrimSpace(*filter.Search)) + "%"
+			query = query.Where("(users.names ILIKE ? OR users.email ILIKE ?)", pattern, pattern)
+		}
+		if filter.Country != nil && *filter.Country != "" {
+			query = query.Where("users.country = ?", utils.NormalizeCountry(*filter.Country))
+		}
+		if filter.Role != nil {
+			query = query.Where("users.role = ?", *filter.Role)
+		}
+	}
+
+	var totalCount int64
+	if err := query.Session(&gorm.Session{}).Count(&totalCount).Error; err != nil {
+		return nil, err
+	}
+
+	if after != nil && *after != "" {
+		cursor, err := utils.DecodeCursor(*after)
+		if err != nil {
+			return nil, err
+		}
+
+		cursorID, err := uuid.FromString(cursor.ID)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+
+		query = query.Where("(users.created_at, users.id) < (?, ?)", cursor.CreatedAt, cursorID)
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	limit := utils.PageSize(first)
+	var users []models.User
+	if err := query.Order("users.created_at DESC").
+		Order("users.id DESC").
+		Limit(limit + 1).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	hasNextPage := len(users) > limit
+	if hasNextPage {
+		users = users[:limit]
+	}
+
+	edges := make([]*model.UserEdge, len(users))
+	for i := range users {
+		edges[i] = &model.UserEdge{
+			Cursor: utils.EncodeCursor(utils.Cursor{
+				CreatedAt: users[i].CreatedAt,
+				ID:        users[i].ID.String(),
+			}),
+			Node: users[i].ToGraphData(),
+		}
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     hasNextPage,
+		HasPreviousPage: after != nil && *after != "",
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.UserConnection{
+		Edges:      edges,
+		PageInfo:   pageInfo,
+		TotalCount: int32(totalCount),
+	}, nil
+}
+
+// SuspendUser stops a user from signing in until they are reactivated
+func SuspendUser(id string, reason *string, actor *models.User) (*model.User, error) {
+	return updateAccount(id, actor, func(user *models.User) (map[string]interface{}, error) {
+		now := time.Now()
+		user.SuspendedAt = &now
+		user.SuspensionReason = ""
+		if reason != nil {
+			user.SuspensionReason = strings.TrimSpace(*reason)
+		}
+
+		return map[string]interface{}{
+			"suspended_at":      user.SuspendedAt,
+			"suspension_reason": user.SuspensionReason,
+		}, nil
+	})
+}
+
+func ReactivateUser(id string, actor *models.User) (*model.User, error) {
+	return updateAccount(id, actor, func(user *models.User) (map[string]interface{}, error) {
+		if user.SuspendedAt == nil {
+			return nil, ErrUserNotSuspended
+		}
+
+		user.SuspendedAt = nil
+		user.SuspensionReason = ""
+
+		return map[string]interface{}{
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		}, nil
+	})
+}
+
+// DeleteUser soft-deletes a user. The row stays so their orders keep their
+// customer, and so signing in again doesn't create a fresh account.
+func DeleteUser(id string, actor *models.User) (bool, error) {
+	_, err := updateAccount(id, actor, func(user *models.User) (map[string]interface{}, error) {
+		now := time.Now()
+		user.DeletedAt = &now
+		user.ClearPasswordResetToken()
+
+		return map[string]interface{}{
+			"deleted_at":            user.DeletedAt,
+			"password_reset_token":  "",
+			"password_reset_expiry": nil,
+		}, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// updateAccount locks a user that isn't deleted and applies change. Users
+// can't change their own account this way, and only admins can change an
+// admin's.
+func updateAccount(id string, actor *models.User, change func(user *models.User) (map[string]interface{}, error)) (*model.User, error) {
+	userUUID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if userUUID == actor.ID {
+		return nil, ErrCannotManageSelf
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrUserNotFound
+	}
+
+	if user.DeletedAt != nil {
+		tx.Rollback()
+		return nil, ErrUserDeleted
+	}
+	if user.Role == models.RoleAdmin && actor.Role != models.RoleAdmin {
+		tx.Rollback()
+		return nil, ErrAdminRequired
+	}
+
+	updates, err := change(&user)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", userUUID).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return user.ToGraphData(), nil
+}
+
+// escapeLike makes LIKE wildcards in user input match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
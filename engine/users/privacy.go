@@ -0,0 +1,93 @@
+package users
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"strings"
+	"unicode/utf8"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// MaskNames keeps the first name and the initials of the rest: Jane D.
+func MaskNames(names string) string {
+	parts := strings.Fields(names)
+	if len(parts) == 0 {
+		return ""
+	}
+
+	masked := parts[0]
+	for _, part := range parts[1:] {
+		initial, _ := utf8.DecodeRuneInString(part)
+		masked += " " + string(initial) + "."
+	}
+	return masked
+}
+
+// MaskEmail keeps the first character and the domain: j***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+
+	first, _ := utf8.DecodeRuneInString(email)
+	return string(first) + "***" + email[at:]
+}
+
+// MaskPhoneNumber keeps the last two digits: ***89
+func MaskPhoneNumber(phoneNumber string) string {
+	if len(phoneNumber) <= 2 {
+		return "***"
+	}
+	return "***" + phoneNumber[len(phoneNumber)-2:]
+}
+
+// CountOrders counts the user's orders that weren't cancelled
+func CountOrders(userID string) (int32, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := utils.DB.Model(&models.Order{}).
+		Where("customer_id = ? AND status <> ?", userUUID, models.OrderStatusCancelled).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return int32(count), nil
+}
+
+// LifetimeSpend totals what the user has paid, less refunds, in each
+// currency they have paid in
+func LifetimeSpend(userID string) ([]*model.Money, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Currency string
+		Amount   int64
+	}
+	if err := utils.DB.Model(&models.Payment{}).
+		Select("payments.amount_currency AS currency, SUM(payments.amount_amount - payments.refunded_amount_amount) AS amount").
+		Joins("JOIN orders ON orders.id = payments.order_id").
+		Where("orders.customer_id = ? AND payments.captured_at IS NOT NULL", userUUID).
+		Group("payments.amount_currency").
+		Order("payments.amount_currency").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.Money, len(rows))
+	for i, row := range rows {
+		amount := model.NewMoney(row.Amount, row.Currency)
+		result[i] = &amount
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package users
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"errors"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRole       = errors.New("invalid role")
+	ErrInvalidPermission = errors.New("invalid permission")
+	ErrAdminRoleFixed    = errors.New("the ADMIN role always has every permission")
+	ErrAdminRequired     = errors.New("only admins can grant or revoke the ADMIN role")
+	ErrLastAdmin         = errors.New("cannot remove the last admin")
+)
+
+func GetRoleDefinitions() ([]*model.RoleDefinition, error) {
+	var definitions []models.RoleDefinition
+	if err := utils.DB.Order("role").Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.RoleDefinition, len(definitions))
+	for i := range definitions {
+		result[i] = definitions[i].ToGraphQL()
+	}
+
+	return result, nil
+}
+
+// SetRolePermissions replaces the permissions a role grants, creating its
+// definition if there isn't one yet
+func SetRolePermissions(role models.Role, permissions []models.Permission, description *string) (*model.RoleDefinition, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+	if role == models.RoleAdmin {
+		return nil, ErrAdminRoleFixed
+	}
+
+	unique := make([]models.Permission, 0, len(permissions))
+	seen := make(map[models.Permission]bool, len(permissions))
+	for _, permission := range permissions {
+		if !permission.IsValid() {
+			return nil, ErrInvalidPermission
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			unique = append(unique, permission)
+		}
+	}
+
+	var definition models.RoleDefinition
+	err := utils.DB.First(&definition, "role = ?", role).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		definition = models.RoleDefinition{Role: role}
+	} else if err != nil {
+		return nil, err
+	}
+
+	definition.Permissions = unique
+	if description != nil {
+		definition.Description = *description
+	}
+
+	if err := utils.DB.Save(&definition).Error; err != nil {
+		return nil, err
+	}
+
+	return definition.ToGraphQL(), nil
+}
+
+// SetUserRole changes a user's role. Only an admin can make someone an
+// admin or change an admin's role, and the last admin can't be demoted.
+func SetUserRole(userID string, role models.Role, actor *models.User) (*model.User, error) {
+	userUUID, err := uuid.FromString(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	tx := utils.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", userUUID).Error; err != nil {
+		tx.Rollback()
+		return nil, ErrUserNotFound
+	}
+
+	if (role == models.RoleAdmin || user.Role == models.RoleAdmin) && actor.Role != models.RoleAdmin {
+		tx.Rollback()
+		return nil, ErrAdminRequired
+	}
+
+	if user.Role == models.RoleAdmin && role != models.RoleAdmin {
+		// Lock the admins so two of them can't demote each other at once
+		var admins []models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("role = ?", models.RoleAdmin).
+			Find(&admins).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if len(admins) <= 1 {
+			tx.Rollback()
+			return nil, ErrLastAdmin
+		}
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", userUUID).Update("role", role).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	return user.ToGraphData(), nil
+}
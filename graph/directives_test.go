@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// Directives that restrict who can call a field
+var authDirectives = []string{"auth", "hasPermission"}
+
+// Queries anyone may call, signed in or not. Every other query and every
+// mutation must carry one of authDirectives.
+var publicQueries = map[string]bool{
+	"categories":           true,
+	"categoryTree":         true,
+	"category":             true,
+	"categoryAveragePrice": true,
+	"exchangeRates":        true,
+	"taxRates":             true,
+	"shippingMethods":      true,
+	"paymentProviders":     true,
+}
+
+// unprotectedFields lists the fields of a root type that have none of
+// authDirectives, other than those in public
+func unprotectedFields(definition *ast.Definition, public map[string]bool) []string {
+	var unprotected []string
+	for _, field := range definition.Fields {
+		if strings.HasPrefix(field.Name, "__") || public[field.Name] {
+			continue
+		}
+
+		protected := false
+		for _, name := range authDirectives {
+			if field.Directives.ForName(name) != nil {
+				protected = true
+				break
+			}
+		}
+		if !protected {
+			unprotected = append(unprotected, field.Name)
+		}
+	}
+	sort.Strings(unprotected)
+	return unprotected
+}
+
+func TestMutationsRequireAuth(t *testing.T) {
+	schema := NewExecutableSchema(Config{}).Schema()
+
+	if unprotected := unprotectedFields(schema.Mutation, nil); len(unprotected) > 0 {
+		t.Errorf("mutations without @auth or @hasPermission: %s", strings.Join(unprotected, ", "))
+	}
+}
+
+func TestQueriesRequireAuth(t *testing.T) {
+	schema := NewExecutableSchema(Config{}).Schema()
+
+	if unprotected := unprotectedFields(schema.Query, publicQueries); len(unprotected) > 0 {
+		t.Errorf("queries without @auth or @hasPermission that aren't listed as public: %s",
+			strings.Join(unprotected, ", "))
+	}
+
+	// Keep the allowlist honest: every entry must be a query, and public
+	// queries shouldn't also be restricted
+	for name := range publicQueries {
+		field := schema.Query.Fields.ForName(name)
+		if field == nil {
+			t.Errorf("public query %s does not exist", name)
+			continue
+		}
+		for _, directive := range authDirectives {
+			if field.Directives.ForName(directive) != nil {
+				t.Errorf("public query %s has @%s", name, directive)
+			}
+		}
+	}
+}
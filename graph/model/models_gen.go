@@ -9,19 +9,72 @@ import (
 	"time"
 )
 
+type Address struct {
+	ID          string    `json:"id"`
+	Label       *string   `json:"label,omitempty"`
+	Recipient   string    `json:"recipient"`
+	PhoneNumber string    `json:"phoneNumber"`
+	Line1       string    `json:"line1"`
+	Line2       *string   `json:"line2,omitempty"`
+	City        string    `json:"city"`
+	Region      *string   `json:"region,omitempty"`
+	PostalCode  *string   `json:"postalCode,omitempty"`
+	Country     string    `json:"country"`
+	IsDefault   bool      `json:"isDefault"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type AddressInput struct {
+	Label       *string `json:"label,omitempty"`
+	Recipient   string  `json:"recipient"`
+	PhoneNumber string  `json:"phoneNumber"`
+	Line1       string  `json:"line1"`
+	Line2       *string `json:"line2,omitempty"`
+	City        string  `json:"city"`
+	Region      *string `json:"region,omitempty"`
+	PostalCode  *string `json:"postalCode,omitempty"`
+	Country     string  `json:"country"`
+	IsDefault   *bool   `json:"isDefault,omitempty"`
+}
+
 type AuthPayload struct {
 	Token string `json:"token"`
 }
 
-type Category struct {
+type Cart struct {
 	ID        string      `json:"id"`
-	Name      string      `json:"name"`
-	ParentID  *string     `json:"parentId,omitempty"`
-	Parent    *Category   `json:"parent,omitempty"`
-	Children  []*Category `json:"children,omitempty"`
-	Products  []*Product  `json:"products,omitempty"`
-	Level     int32       `json:"level"`
-	CreatedAt time.Time   `json:"createdAt"`
+	Items     []*CartItem `json:"items"`
+	Total     Money       `json:"total"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+type CartItem struct {
+	ID       string          `json:"id"`
+	Product  *Product        `json:"product"`
+	Variant  *ProductVariant `json:"variant,omitempty"`
+	Quantity int32           `json:"quantity"`
+	SubTotal Money           `json:"subTotal"`
+}
+
+type Category struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	ParentID    *string     `json:"parentId,omitempty"`
+	Parent      *Category   `json:"parent,omitempty"`
+	Children    []*Category `json:"children,omitempty"`
+	Products    []*Product  `json:"products,omitempty"`
+	Level       int32       `json:"level"`
+	Ancestors   []*Category `json:"ancestors"`
+	Descendants []*Category `json:"descendants"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+type CategoryFacet struct {
+	CategoryID string  `json:"categoryId"`
+	Name       string  `json:"name"`
+	ParentID   *string `json:"parentId,omitempty"`
+	Level      int32   `json:"level"`
+	Count      int32   `json:"count"`
 }
 
 type CategoryInput struct {
@@ -29,6 +82,32 @@ type CategoryInput struct {
 	ParentID *string `json:"parentId,omitempty"`
 }
 
+type CheckoutInput struct {
+	Currency          *string `json:"currency,omitempty"`
+	CouponCode        *string `json:"couponCode,omitempty"`
+	ShippingAddressID *string `json:"shippingAddressId,omitempty"`
+	ShippingMethodID  *string `json:"shippingMethodId,omitempty"`
+}
+
+type ExchangeRate struct {
+	ID            string    `json:"id"`
+	BaseCurrency  string    `json:"baseCurrency"`
+	QuoteCurrency string    `json:"quoteCurrency"`
+	Rate          string    `json:"rate"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type InventoryMovement struct {
+	ID          string          `json:"id"`
+	VariantID   *string         `json:"variantId,omitempty"`
+	Delta       int32           `json:"delta"`
+	Reason      InventoryReason `json:"reason"`
+	ReferenceID *string         `json:"referenceId,omitempty"`
+	Actor       *User           `json:"actor,omitempty"`
+	Note        *string         `json:"note,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
 type LoginInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -37,30 +116,88 @@ type LoginInput struct {
 type Mutation struct {
 }
 
+type OptionFacet struct {
+	Name   string              `json:"name"`
+	Values []*OptionValueCount `json:"values"`
+}
+
+type OptionValueCount struct {
+	Value string `json:"value"`
+	Count int32  `json:"count"`
+}
+
 type Order struct {
-	ID        string       `json:"id"`
-	Customer  *User        `json:"customer"`
-	Items     []*OrderItem `json:"items"`
-	Status    OrderStatus  `json:"status"`
-	Total     float64      `json:"total"`
-	CreatedAt time.Time    `json:"createdAt"`
+	ID              string               `json:"id"`
+	Customer        *User                `json:"customer"`
+	Items           []*OrderItem         `json:"items"`
+	Status          OrderStatus          `json:"status"`
+	Currency        string               `json:"currency"`
+	Subtotal        Money                `json:"subtotal"`
+	DiscountTotal   Money                `json:"discountTotal"`
+	Discounts       []*OrderDiscount     `json:"discounts"`
+	TaxAmount       Money                `json:"taxAmount"`
+	TaxRate         *string              `json:"taxRate,omitempty"`
+	ShippingAddress *PostalAddress       `json:"shippingAddress,omitempty"`
+	ShippingMethod  *string              `json:"shippingMethod,omitempty"`
+	ShippingCost    Money                `json:"shippingCost"`
+	Total           Money                `json:"total"`
+	StatusHistory   []*OrderStatusChange `json:"statusHistory"`
+	Payments        []*Payment           `json:"payments"`
+	Returns         []*ReturnRequest     `json:"returns"`
+	RefundedAmount  Money                `json:"refundedAmount"`
+	RefundStatus    OrderRefundStatus    `json:"refundStatus"`
+	CreatedAt       time.Time            `json:"createdAt"`
+}
+
+type OrderDiscount struct {
+	ID          string  `json:"id"`
+	Code        string  `json:"code"`
+	Description *string `json:"description,omitempty"`
+	Amount      Money   `json:"amount"`
 }
 
 type OrderInput struct {
-	Items []*OrderItemInput `json:"items"`
+	Items             []*OrderItemInput `json:"items"`
+	Currency          *string           `json:"currency,omitempty"`
+	CouponCode        *string           `json:"couponCode,omitempty"`
+	ShippingAddressID *string           `json:"shippingAddressId,omitempty"`
+	ShippingMethodID  *string           `json:"shippingMethodId,omitempty"`
 }
 
 type OrderItem struct {
-	ID        string   `json:"id"`
-	Product   *Product `json:"product"`
-	Quantity  int32    `json:"quantity"`
-	UnitPrice float64  `json:"unitPrice"`
-	SubTotal  float64  `json:"subTotal"`
+	ID            string          `json:"id"`
+	Product       *Product        `json:"product"`
+	Variant       *ProductVariant `json:"variant,omitempty"`
+	Quantity      int32           `json:"quantity"`
+	UnitPrice     Money           `json:"unitPrice"`
+	SubTotal      Money           `json:"subTotal"`
+	BaseUnitPrice Money           `json:"baseUnitPrice"`
+	ExchangeRate  string          `json:"exchangeRate"`
+	TaxRate       string          `json:"taxRate"`
+	TaxAmount     Money           `json:"taxAmount"`
+	TaxInclusive  bool            `json:"taxInclusive"`
 }
 
 type OrderItemInput struct {
-	ProductID string `json:"productId"`
-	Quantity  int32  `json:"quantity"`
+	ProductID string  `json:"productId"`
+	VariantID *string `json:"variantId,omitempty"`
+	Quantity  int32   `json:"quantity"`
+}
+
+type OrderStatusChange struct {
+	ID         string       `json:"id"`
+	FromStatus *OrderStatus `json:"fromStatus,omitempty"`
+	ToStatus   OrderStatus  `json:"toStatus"`
+	Actor      *User        `json:"actor,omitempty"`
+	Note       *string      `json:"note,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+}
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
 }
 
 type PasswordResetInput struct {
@@ -69,24 +206,204 @@ type PasswordResetInput struct {
 	ConfirmPassword string `json:"confirmPassword"`
 }
 
+type Payment struct {
+	ID             string           `json:"id"`
+	Provider       string           `json:"provider"`
+	Status         PaymentStatus    `json:"status"`
+	Amount         Money            `json:"amount"`
+	RefundedAmount Money            `json:"refundedAmount"`
+	Receipt        *string          `json:"receipt,omitempty"`
+	FailureReason  *string          `json:"failureReason,omitempty"`
+	CapturedAt     *time.Time       `json:"capturedAt,omitempty"`
+	Refunds        []*PaymentRefund `json:"refunds"`
+	CreatedAt      time.Time        `json:"createdAt"`
+}
+
+type PaymentRefund struct {
+	ID            string       `json:"id"`
+	Amount        Money        `json:"amount"`
+	Status        RefundStatus `json:"status"`
+	Reason        *string      `json:"reason,omitempty"`
+	FailureReason *string      `json:"failureReason,omitempty"`
+	CreatedAt     time.Time    `json:"createdAt"`
+}
+
+type PaymentSession struct {
+	Payment         *Payment `json:"payment"`
+	ClientSecret    *string  `json:"clientSecret,omitempty"`
+	CustomerMessage *string  `json:"customerMessage,omitempty"`
+}
+
+type PostalAddress struct {
+	Recipient   string  `json:"recipient"`
+	PhoneNumber string  `json:"phoneNumber"`
+	Line1       string  `json:"line1"`
+	Line2       *string `json:"line2,omitempty"`
+	City        string  `json:"city"`
+	Region      *string `json:"region,omitempty"`
+	PostalCode  *string `json:"postalCode,omitempty"`
+	Country     string  `json:"country"`
+}
+
+type PriceBucket struct {
+	Min   Money  `json:"min"`
+	Max   *Money `json:"max,omitempty"`
+	Count int32  `json:"count"`
+}
+
 type Product struct {
-	ID          string      `json:"id"`
-	Name        string      `json:"name"`
-	Description *string     `json:"description,omitempty"`
-	Price       float64     `json:"price"`
-	Sku         string      `json:"sku"`
-	Categories  []*Category `json:"categories"`
-	Stock       int32       `json:"stock"`
-	CreatedAt   time.Time   `json:"createdAt"`
+	ID           string               `json:"id"`
+	Name         string               `json:"name"`
+	Description  *string              `json:"description,omitempty"`
+	Price        Money                `json:"price"`
+	BasePrice    Money                `json:"basePrice"`
+	Sku          string               `json:"sku"`
+	Categories   []*Category          `json:"categories"`
+	Stock        int32                `json:"stock"`
+	Weight       int32                `json:"weight"`
+	Options      []*ProductOption     `json:"options"`
+	Variants     []*ProductVariant    `json:"variants"`
+	Images       []*ProductImage      `json:"images"`
+	StockHistory []*InventoryMovement `json:"stockHistory"`
+	CreatedAt    time.Time            `json:"createdAt"`
+}
+
+type ProductConnection struct {
+	Edges      []*ProductEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int32          `json:"totalCount"`
+}
+
+type ProductEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+}
+
+type ProductFacets struct {
+	TotalCount   int32            `json:"totalCount"`
+	Categories   []*CategoryFacet `json:"categories"`
+	PriceBuckets []*PriceBucket   `json:"priceBuckets"`
+	InStock      int32            `json:"inStock"`
+	OutOfStock   int32            `json:"outOfStock"`
+	Options      []*OptionFacet   `json:"options"`
+}
+
+type ProductFilter struct {
+	Search      *string  `json:"search,omitempty"`
+	CategoryIds []string `json:"categoryIds,omitempty"`
+	MinPrice    *Money   `json:"minPrice,omitempty"`
+	MaxPrice    *Money   `json:"maxPrice,omitempty"`
+	InStockOnly *bool    `json:"inStockOnly,omitempty"`
+}
+
+type ProductImage struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl"`
+	AltText      *string   `json:"altText,omitempty"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	Position     int32     `json:"position"`
+	IsPrimary    bool      `json:"isPrimary"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type ProductImageInput struct {
+	AltText   *string `json:"altText,omitempty"`
+	Position  *int32  `json:"position,omitempty"`
+	IsPrimary *bool   `json:"isPrimary,omitempty"`
 }
 
 type ProductInput struct {
 	Name        string   `json:"name"`
 	Description *string  `json:"description,omitempty"`
-	Price       float64  `json:"price"`
+	Price       Money    `json:"price"`
 	Sku         string   `json:"sku"`
 	CategoryIds []string `json:"categoryIds"`
 	Stock       int32    `json:"stock"`
+	Weight      *int32   `json:"weight,omitempty"`
+}
+
+type ProductOption struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOptionInput struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOrder struct {
+	Field     ProductOrderField `json:"field"`
+	Direction SortDirection     `json:"direction"`
+}
+
+type ProductSearchConnection struct {
+	Edges      []*ProductSearchEdge `json:"edges"`
+	PageInfo   *PageInfo            `json:"pageInfo"`
+	TotalCount int32                `json:"totalCount"`
+	Fuzzy      bool                 `json:"fuzzy"`
+}
+
+type ProductSearchEdge struct {
+	Cursor  string   `json:"cursor"`
+	Node    *Product `json:"node"`
+	Score   float64  `json:"score"`
+	Snippet *string  `json:"snippet,omitempty"`
+}
+
+type ProductVariant struct {
+	ID        string            `json:"id"`
+	Sku       string            `json:"sku"`
+	Price     Money             `json:"price"`
+	BasePrice Money             `json:"basePrice"`
+	Stock     int32             `json:"stock"`
+	Options   []*SelectedOption `json:"options"`
+}
+
+type ProductVariantInput struct {
+	Sku     string                 `json:"sku"`
+	Price   *Money                 `json:"price,omitempty"`
+	Stock   int32                  `json:"stock"`
+	Options []*SelectedOptionInput `json:"options"`
+}
+
+type Promotion struct {
+	ID               string         `json:"id"`
+	Code             string         `json:"code"`
+	Description      *string        `json:"description,omitempty"`
+	Type             PromotionType  `json:"type"`
+	PercentOff       *int32         `json:"percentOff,omitempty"`
+	AmountOff        *Money         `json:"amountOff,omitempty"`
+	Scope            PromotionScope `json:"scope"`
+	Categories       []*Category    `json:"categories"`
+	Products         []*Product     `json:"products"`
+	MinOrderValue    *Money         `json:"minOrderValue,omitempty"`
+	UsageLimit       *int32         `json:"usageLimit,omitempty"`
+	PerCustomerLimit *int32         `json:"perCustomerLimit,omitempty"`
+	TimesUsed        int32          `json:"timesUsed"`
+	StartsAt         *time.Time     `json:"startsAt,omitempty"`
+	EndsAt           *time.Time     `json:"endsAt,omitempty"`
+	Active           bool           `json:"active"`
+	CreatedAt        time.Time      `json:"createdAt"`
+}
+
+type PromotionInput struct {
+	Code             string         `json:"code"`
+	Description      *string        `json:"description,omitempty"`
+	Type             PromotionType  `json:"type"`
+	PercentOff       *int32         `json:"percentOff,omitempty"`
+	AmountOff        *Money         `json:"amountOff,omitempty"`
+	Scope            PromotionScope `json:"scope"`
+	CategoryIds      []string       `json:"categoryIds,omitempty"`
+	ProductIds       []string       `json:"productIds,omitempty"`
+	MinOrderValue    *Money         `json:"minOrderValue,omitempty"`
+	UsageLimit       *int32         `json:"usageLimit,omitempty"`
+	PerCustomerLimit *int32         `json:"perCustomerLimit,omitempty"`
+	StartsAt         *time.Time     `json:"startsAt,omitempty"`
+	EndsAt           *time.Time     `json:"endsAt,omitempty"`
 }
 
 type Query struct {
@@ -102,20 +419,284 @@ type RegisterUserInput struct {
 	Role            Role   `json:"role"`
 }
 
+type ReturnItem struct {
+	ID        string     `json:"id"`
+	OrderItem *OrderItem `json:"orderItem"`
+	Quantity  int32      `json:"quantity"`
+}
+
+type ReturnItemInput struct {
+	OrderItemID string `json:"orderItemId"`
+	Quantity    int32  `json:"quantity"`
+}
+
+type ReturnRequest struct {
+	ID           string         `json:"id"`
+	OrderID      string         `json:"orderId"`
+	Status       ReturnStatus   `json:"status"`
+	Reason       string         `json:"reason"`
+	AdminNote    *string        `json:"adminNote,omitempty"`
+	Items        []*ReturnItem  `json:"items"`
+	RefundAmount *Money         `json:"refundAmount,omitempty"`
+	Refund       *PaymentRefund `json:"refund,omitempty"`
+	ReviewedAt   *time.Time     `json:"reviewedAt,omitempty"`
+	ReceivedAt   *time.Time     `json:"receivedAt,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+type ReturnRequestInput struct {
+	OrderID string             `json:"orderId"`
+	Reason  string             `json:"reason"`
+	Items   []*ReturnItemInput `json:"items"`
+}
+
+type RoleDefinition struct {
+	Role        Role         `json:"role"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+type SelectedOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type SelectedOptionInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ShippingMethod struct {
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	Country       string              `json:"country"`
+	Type          ShippingRateType    `json:"type"`
+	FlatRate      *Money              `json:"flatRate,omitempty"`
+	Tiers         []*ShippingRateTier `json:"tiers"`
+	EstimatedDays *int32              `json:"estimatedDays,omitempty"`
+	Active        bool                `json:"active"`
+	CreatedAt     time.Time           `json:"createdAt"`
+}
+
+type ShippingMethodInput struct {
+	Name          string                   `json:"name"`
+	Country       string                   `json:"country"`
+	Type          ShippingRateType         `json:"type"`
+	FlatRate      *Money                   `json:"flatRate,omitempty"`
+	Tiers         []*ShippingRateTierInput `json:"tiers,omitempty"`
+	EstimatedDays *int32                   `json:"estimatedDays,omitempty"`
+}
+
+type ShippingRateTier struct {
+	MinWeight     *int32 `json:"minWeight,omitempty"`
+	MinOrderValue *Money `json:"minOrderValue,omitempty"`
+	Cost          Money  `json:"cost"`
+}
+
+type ShippingRateTierInput struct {
+	MinWeight     *int32 `json:"minWeight,omitempty"`
+	MinOrderValue *Money `json:"minOrderValue,omitempty"`
+	Cost          Money  `json:"cost"`
+}
+
+type StockDiscrepancy struct {
+	Product     *Product `json:"product"`
+	Stock       int32    `json:"stock"`
+	LedgerStock int32    `json:"ledgerStock"`
+}
+
+type TaxRate struct {
+	ID               string    `json:"id"`
+	Country          string    `json:"country"`
+	Category         *Category `json:"category,omitempty"`
+	Name             string    `json:"name"`
+	Rate             string    `json:"rate"`
+	PricesIncludeTax bool      `json:"pricesIncludeTax"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+type TaxRateInput struct {
+	Country          string  `json:"country"`
+	CategoryID       *string `json:"categoryId,omitempty"`
+	Name             string  `json:"name"`
+	Rate             string  `json:"rate"`
+	PricesIncludeTax bool    `json:"pricesIncludeTax"`
+}
+
 type UpdateProfileInput struct {
 	PhoneNumber *string `json:"phoneNumber,omitempty"`
 	Country     *string `json:"country,omitempty"`
 }
 
 type User struct {
-	ID          string    `json:"id"`
-	Names       string    `json:"names"`
-	Email       string    `json:"email"`
-	Password    string    `json:"password"`
-	PhoneNumber string    `json:"phoneNumber"`
-	Country     string    `json:"country"`
-	Role        Role      `json:"role"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID               string     `json:"id"`
+	Names            string     `json:"names"`
+	Email            string     `json:"email"`
+	PhoneNumber      string     `json:"phoneNumber"`
+	Country          string     `json:"country"`
+	Role             Role       `json:"role"`
+	LastLoginAt      *time.Time `json:"lastLoginAt,omitempty"`
+	OrderCount       *int32     `json:"orderCount,omitempty"`
+	LifetimeSpend    []*Money   `json:"lifetimeSpend,omitempty"`
+	Status           UserStatus `json:"status"`
+	SuspendedAt      *time.Time `json:"suspendedAt,omitempty"`
+	SuspensionReason *string    `json:"suspensionReason,omitempty"`
+	Orders           []*Order   `json:"orders"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+type UserConnection struct {
+	Edges      []*UserEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount int32       `json:"totalCount"`
+}
+
+type UserEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *User  `json:"node"`
+}
+
+type UserFilter struct {
+	Search  *string     `json:"search,omitempty"`
+	Country *string     `json:"country,omitempty"`
+	Role    *Role       `json:"role,omitempty"`
+	Status  *UserStatus `json:"status,omitempty"`
+}
+
+type CategoryDeleteStrategy string
+
+const (
+	CategoryDeleteStrategyReject   CategoryDeleteStrategy = "REJECT"
+	CategoryDeleteStrategyReparent CategoryDeleteStrategy = "REPARENT"
+	CategoryDeleteStrategyCascade  CategoryDeleteStrategy = "CASCADE"
+)
+
+var AllCategoryDeleteStrategy = []CategoryDeleteStrategy{
+	CategoryDeleteStrategyReject,
+	CategoryDeleteStrategyReparent,
+	CategoryDeleteStrategyCascade,
+}
+
+func (e CategoryDeleteStrategy) IsValid() bool {
+	switch e {
+	case CategoryDeleteStrategyReject, CategoryDeleteStrategyReparent, CategoryDeleteStrategyCascade:
+		return true
+	}
+	return false
+}
+
+func (e CategoryDeleteStrategy) String() string {
+	return string(e)
+}
+
+func (e *CategoryDeleteStrategy) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CategoryDeleteStrategy(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CategoryDeleteStrategy", str)
+	}
+	return nil
+}
+
+func (e CategoryDeleteStrategy) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type InventoryReason string
+
+const (
+	InventoryReasonSale             InventoryReason = "SALE"
+	InventoryReasonCancellation     InventoryReason = "CANCELLATION"
+	InventoryReasonManualAdjustment InventoryReason = "MANUAL_ADJUSTMENT"
+	InventoryReasonReceipt          InventoryReason = "RECEIPT"
+	InventoryReasonReturn           InventoryReason = "RETURN"
+	InventoryReasonReconciliation   InventoryReason = "RECONCILIATION"
+)
+
+var AllInventoryReason = []InventoryReason{
+	InventoryReasonSale,
+	InventoryReasonCancellation,
+	InventoryReasonManualAdjustment,
+	InventoryReasonReceipt,
+	InventoryReasonReturn,
+	InventoryReasonReconciliation,
+}
+
+func (e InventoryReason) IsValid() bool {
+	switch e {
+	case InventoryReasonSale, InventoryReasonCancellation, InventoryReasonManualAdjustment, InventoryReasonReceipt, InventoryReasonReturn, InventoryReasonReconciliation:
+		return true
+	}
+	return false
+}
+
+func (e InventoryReason) String() string {
+	return string(e)
+}
+
+func (e *InventoryReason) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = InventoryReason(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid InventoryReason", str)
+	}
+	return nil
+}
+
+func (e InventoryReason) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderRefundStatus string
+
+const (
+	OrderRefundStatusNone              OrderRefundStatus = "NONE"
+	OrderRefundStatusPartiallyRefunded OrderRefundStatus = "PARTIALLY_REFUNDED"
+	OrderRefundStatusRefunded          OrderRefundStatus = "REFUNDED"
+)
+
+var AllOrderRefundStatus = []OrderRefundStatus{
+	OrderRefundStatusNone,
+	OrderRefundStatusPartiallyRefunded,
+	OrderRefundStatusRefunded,
+}
+
+func (e OrderRefundStatus) IsValid() bool {
+	switch e {
+	case OrderRefundStatusNone, OrderRefundStatusPartiallyRefunded, OrderRefundStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e OrderRefundStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderRefundStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderRefundStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderRefundStatus", str)
+	}
+	return nil
+}
+
+func (e OrderRefundStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
 type OrderStatus string
@@ -163,21 +744,358 @@ func (e OrderStatus) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type PaymentStatus string
+
+const (
+	PaymentStatusPending           PaymentStatus = "PENDING"
+	PaymentStatusCaptured          PaymentStatus = "CAPTURED"
+	PaymentStatusFailed            PaymentStatus = "FAILED"
+	PaymentStatusPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+	PaymentStatusRefunded          PaymentStatus = "REFUNDED"
+)
+
+var AllPaymentStatus = []PaymentStatus{
+	PaymentStatusPending,
+	PaymentStatusCaptured,
+	PaymentStatusFailed,
+	PaymentStatusPartiallyRefunded,
+	PaymentStatusRefunded,
+}
+
+func (e PaymentStatus) IsValid() bool {
+	switch e {
+	case PaymentStatusPending, PaymentStatusCaptured, PaymentStatusFailed, PaymentStatusPartiallyRefunded, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e PaymentStatus) String() string {
+	return string(e)
+}
+
+func (e *PaymentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PaymentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PaymentStatus", str)
+	}
+	return nil
+}
+
+func (e PaymentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Permission string
+
+const (
+	PermissionProductWrite   Permission = "PRODUCT_WRITE"
+	PermissionCategoryWrite  Permission = "CATEGORY_WRITE"
+	PermissionInventoryWrite Permission = "INVENTORY_WRITE"
+	PermissionOrderRead      Permission = "ORDER_READ"
+	PermissionOrderStatus    Permission = "ORDER_STATUS"
+	PermissionReturnManage   Permission = "RETURN_MANAGE"
+	PermissionPaymentRefund  Permission = "PAYMENT_REFUND"
+	PermissionPromotionWrite Permission = "PROMOTION_WRITE"
+	PermissionTaxWrite       Permission = "TAX_WRITE"
+	PermissionShippingWrite  Permission = "SHIPPING_WRITE"
+	PermissionCurrencyWrite  Permission = "CURRENCY_WRITE"
+	PermissionUserRead       Permission = "USER_READ"
+	PermissionUserWrite      Permission = "USER_WRITE"
+	PermissionRoleManage     Permission = "ROLE_MANAGE"
+)
+
+var AllPermission = []Permission{
+	PermissionProductWrite,
+	PermissionCategoryWrite,
+	PermissionInventoryWrite,
+	PermissionOrderRead,
+	PermissionOrderStatus,
+	PermissionReturnManage,
+	PermissionPaymentRefund,
+	PermissionPromotionWrite,
+	PermissionTaxWrite,
+	PermissionShippingWrite,
+	PermissionCurrencyWrite,
+	PermissionUserRead,
+	PermissionUserWrite,
+	PermissionRoleManage,
+}
+
+func (e Permission) IsValid() bool {
+	switch e {
+	case PermissionProductWrite, PermissionCategoryWrite, PermissionInventoryWrite, PermissionOrderRead, PermissionOrderStatus, PermissionReturnManage, PermissionPaymentRefund, PermissionPromotionWrite, PermissionTaxWrite, PermissionShippingWrite, PermissionCurrencyWrite, PermissionUserRead, PermissionUserWrite, PermissionRoleManage:
+		return true
+	}
+	return false
+}
+
+func (e Permission) String() string {
+	return string(e)
+}
+
+func (e *Permission) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Permission(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Permission", str)
+	}
+	return nil
+}
+
+func (e Permission) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductOrderField string
+
+const (
+	ProductOrderFieldCreatedAt ProductOrderField = "CREATED_AT"
+	ProductOrderFieldPrice     ProductOrderField = "PRICE"
+	ProductOrderFieldName      ProductOrderField = "NAME"
+	ProductOrderFieldStock     ProductOrderField = "STOCK"
+)
+
+var AllProductOrderField = []ProductOrderField{
+	ProductOrderFieldCreatedAt,
+	ProductOrderFieldPrice,
+	ProductOrderFieldName,
+	ProductOrderFieldStock,
+}
+
+func (e ProductOrderField) IsValid() bool {
+	switch e {
+	case ProductOrderFieldCreatedAt, ProductOrderFieldPrice, ProductOrderFieldName, ProductOrderFieldStock:
+		return true
+	}
+	return false
+}
+
+func (e ProductOrderField) String() string {
+	return string(e)
+}
+
+func (e *ProductOrderField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductOrderField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductOrderField", str)
+	}
+	return nil
+}
+
+func (e ProductOrderField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PromotionScope string
+
+const (
+	PromotionScopeOrder    PromotionScope = "ORDER"
+	PromotionScopeCategory PromotionScope = "CATEGORY"
+	PromotionScopeProduct  PromotionScope = "PRODUCT"
+)
+
+var AllPromotionScope = []PromotionScope{
+	PromotionScopeOrder,
+	PromotionScopeCategory,
+	PromotionScopeProduct,
+}
+
+func (e PromotionScope) IsValid() bool {
+	switch e {
+	case PromotionScopeOrder, PromotionScopeCategory, PromotionScopeProduct:
+		return true
+	}
+	return false
+}
+
+func (e PromotionScope) String() string {
+	return string(e)
+}
+
+func (e *PromotionScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PromotionScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PromotionScope", str)
+	}
+	return nil
+}
+
+func (e PromotionScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type PromotionType string
+
+const (
+	PromotionTypePercentage PromotionType = "PERCENTAGE"
+	PromotionTypeFixed      PromotionType = "FIXED"
+)
+
+var AllPromotionType = []PromotionType{
+	PromotionTypePercentage,
+	PromotionTypeFixed,
+}
+
+func (e PromotionType) IsValid() bool {
+	switch e {
+	case PromotionTypePercentage, PromotionTypeFixed:
+		return true
+	}
+	return false
+}
+
+func (e PromotionType) String() string {
+	return string(e)
+}
+
+func (e *PromotionType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PromotionType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PromotionType", str)
+	}
+	return nil
+}
+
+func (e PromotionType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "PENDING"
+	RefundStatusSucceeded RefundStatus = "SUCCEEDED"
+	RefundStatusFailed    RefundStatus = "FAILED"
+)
+
+var AllRefundStatus = []RefundStatus{
+	RefundStatusPending,
+	RefundStatusSucceeded,
+	RefundStatusFailed,
+}
+
+func (e RefundStatus) IsValid() bool {
+	switch e {
+	case RefundStatusPending, RefundStatusSucceeded, RefundStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e RefundStatus) String() string {
+	return string(e)
+}
+
+func (e *RefundStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RefundStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RefundStatus", str)
+	}
+	return nil
+}
+
+func (e RefundStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "REQUESTED"
+	ReturnStatusApproved  ReturnStatus = "APPROVED"
+	ReturnStatusRejected  ReturnStatus = "REJECTED"
+	ReturnStatusReceived  ReturnStatus = "RECEIVED"
+	ReturnStatusRefunded  ReturnStatus = "REFUNDED"
+)
+
+var AllReturnStatus = []ReturnStatus{
+	ReturnStatusRequested,
+	ReturnStatusApproved,
+	ReturnStatusRejected,
+	ReturnStatusReceived,
+	ReturnStatusRefunded,
+}
+
+func (e ReturnStatus) IsValid() bool {
+	switch e {
+	case ReturnStatusRequested, ReturnStatusApproved, ReturnStatusRejected, ReturnStatusReceived, ReturnStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e ReturnStatus) String() string {
+	return string(e)
+}
+
+func (e *ReturnStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReturnStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReturnStatus", str)
+	}
+	return nil
+}
+
+func (e ReturnStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type Role string
 
 const (
-	RoleUser  Role = "USER"
-	RoleAdmin Role = "ADMIN"
+	RoleUser           Role = "USER"
+	RoleAdmin          Role = "ADMIN"
+	RoleCatalogManager Role = "CATALOG_MANAGER"
+	RoleFulfillment    Role = "FULFILLMENT"
+	RoleSupport        Role = "SUPPORT"
 )
 
 var AllRole = []Role{
 	RoleUser,
 	RoleAdmin,
+	RoleCatalogManager,
+	RoleFulfillment,
+	RoleSupport,
 }
 
 func (e Role) IsValid() bool {
 	switch e {
-	case RoleUser, RoleAdmin:
+	case RoleUser, RoleAdmin, RoleCatalogManager, RoleFulfillment, RoleSupport:
 		return true
 	}
 	return false
@@ -203,3 +1121,130 @@ func (e *Role) UnmarshalGQL(v any) error {
 func (e Role) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type ShippingRateType string
+
+const (
+	ShippingRateTypeFlat         ShippingRateType = "FLAT"
+	ShippingRateTypeWeightTiered ShippingRateType = "WEIGHT_TIERED"
+	ShippingRateTypePriceTiered  ShippingRateType = "PRICE_TIERED"
+)
+
+var AllShippingRateType = []ShippingRateType{
+	ShippingRateTypeFlat,
+	ShippingRateTypeWeightTiered,
+	ShippingRateTypePriceTiered,
+}
+
+func (e ShippingRateType) IsValid() bool {
+	switch e {
+	case ShippingRateTypeFlat, ShippingRateTypeWeightTiered, ShippingRateTypePriceTiered:
+		return true
+	}
+	return false
+}
+
+func (e ShippingRateType) String() string {
+	return string(e)
+}
+
+func (e *ShippingRateType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ShippingRateType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ShippingRateType", str)
+	}
+	return nil
+}
+
+func (e ShippingRateType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "ACTIVE"
+	UserStatusSuspended UserStatus = "SUSPENDED"
+	UserStatusDeleted   UserStatus = "DELETED"
+)
+
+var AllUserStatus = []UserStatus{
+	UserStatusActive,
+	UserStatusSuspended,
+	UserStatusDeleted,
+}
+
+func (e UserStatus) IsValid() bool {
+	switch e {
+	case UserStatusActive, UserStatusSuspended, UserStatusDeleted:
+		return true
+	}
+	return false
+}
+
+func (e UserStatus) String() string {
+	return string(e)
+}
+
+func (e *UserStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserStatus", str)
+	}
+	return nil
+}
+
+func (e UserStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,261 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount of a single currency, stored as an integer number
+// of minor units (cents for USD, no subdivision for JPY) plus an ISO 4217
+// code.
+//
+// Rounding rules:
+//   - Parsing never rounds: an amount with more decimal places than the
+//     currency allows is rejected.
+//   - Adding and multiplying by whole quantities is exact.
+//   - Scaling by a fraction (tax rates, discounts, exchange rates) goes
+//     through MulRat, which rounds half away from zero to the nearest minor
+//     unit. It is the only place rounding happens.
+//
+// In GraphQL it is the Money scalar, serialised as
+// {"amount": "19.99", "currency": "USD"}.
+type Money struct {
+	Amount   int64  `gorm:"not null;default:0"`
+	Currency string `gorm:"type:char(3);not null;default:'USD'"`
+}
+
+var (
+	ErrCurrencyMismatch = errors.New("cannot combine amounts in different currencies")
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrInvalidCurrency  = errors.New("invalid currency code")
+)
+
+// Number of minor unit digits for currencies that don't use two, per ISO 4217
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0,
+	"KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0,
+	"VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3,
+	"TND": 3,
+}
+
+// Active ISO 4217 currency codes, excluding funds and precious metals
+var currencyCodes = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "ANG": true,
+	"AOA": true, "ARS": true, "AUD": true, "AWG": true, "AZN": true,
+	"BAM": true, "BBD": true, "BDT": true, "BGN": true, "BHD": true,
+	"BIF": true, "BMD": true, "BND": true, "BOB": true, "BRL": true,
+	"BSD": true, "BTN": true, "BWP": true, "BYN": true, "BZD": true,
+	"CAD": true, "CDF": true, "CHF": true, "CLP": true, "CNY": true,
+	"COP": true, "CRC": true, "CUP": true, "CVE": true, "CZK": true,
+	"DJF": true, "DKK": true, "DOP": true, "DZD": true, "EGP": true,
+	"ERN": true, "ETB": true, "EUR": true, "FJD": true, "FKP": true,
+	"GBP": true, "GEL": true, "GHS": true, "GIP": true, "GMD": true,
+	"GNF": true, "GTQ": true, "GYD": true, "HKD": true, "HNL": true,
+	"HTG": true, "HUF": true, "IDR": true, "ILS": true, "INR": true,
+	"IQD": true, "IRR": true, "ISK": true, "JMD": true, "JOD": true,
+	"JPY": true, "KES": true, "KGS": true, "KHR": true, "KMF": true,
+	"KPW": true, "KRW": true, "KWD": true, "KYD": true, "KZT": true,
+	"LAK": true, "LBP": true, "LKR": true, "LRD": true, "LSL": true,
+	"LYD": true, "MAD": true, "MDL": true, "MGA": true, "MKD": true,
+	"MMK": true, "MNT": true, "MOP": true, "MRU": true, "MUR": true,
+	"MVR": true, "MWK": true, "MXN": true, "MYR": true, "MZN": true,
+	"NAD": true, "NGN": true, "NIO": true, "NOK": true, "NPR": true,
+	"NZD": true, "OMR": true, "PAB": true, "PEN": true, "PGK": true,
+	"PHP": true, "PKR": true, "PLN": true, "PYG": true, "QAR": true,
+	"RON": true, "RSD": true, "RUB": true, "RWF": true, "SAR": true,
+	"SBD": true, "SCR": true, "SDG": true, "SEK": true, "SGD": true,
+	"SHP": true, "SLE": true, "SOS": true, "SRD": true, "SSP": true,
+	"STN": true, "SVC": true, "SYP": true, "SZL": true, "THB": true,
+	"TJS": true, "TMT": true, "TND": true, "TOP": true, "TRY": true,
+	"TTD": true, "TWD": true, "TZS": true, "UAH": true, "UGX": true,
+	"USD": true, "UYU": true, "UZS": true, "VES": true, "VND": true,
+	"VUV": true, "WST": true, "XAF": true, "XCD": true, "XOF": true,
+	"XPF": true, "YER": true, "ZAR": true, "ZMW": true, "ZWL": true,
+}
+
+// IsCurrency reports whether code is an active ISO 4217 currency code
+func IsCurrency(code string) bool {
+	return currencyCodes[code]
+}
+
+// DefaultCurrency is used for amounts given without a currency
+func DefaultCurrency() string {
+	if currency := os.Getenv("DEFAULT_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// CurrencyExponent returns how many decimal places the currency uses
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "19.99" in the given currency
+func ParseMoney(amount string, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if !IsCurrency(currency) {
+		return Money{}, ErrInvalidCurrency
+	}
+
+	amount = strings.TrimSpace(amount)
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+
+	whole, fraction, _ := strings.Cut(amount, ".")
+	exponent := CurrencyExponent(currency)
+	if whole == "" || len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%w: %q has too many decimal places for %s", ErrInvalidAmount, amount, currency)
+	}
+
+	digits := whole + fraction + strings.Repeat("0", exponent-len(fraction))
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// Add returns m + other. A zero value with no currency adopts the other
+// currency, so totals can be accumulated from Money{}.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency == "" {
+		return other, nil
+	}
+	if other.Currency != "" && other.Currency != m.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(other.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Mul multiplies by a whole quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// MulRat multiplies by an arbitrary ratio, rounding half away from zero
+func (m Money) MulRat(ratio *big.Rat) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), ratio)
+
+	num := new(big.Int).Set(product.Num())
+	den := product.Denom()
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	// Add half the denominator before truncating
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if negative {
+		num.Neg(num)
+	}
+
+	return Money{Amount: num.Int64(), Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Decimal formats the amount without the currency, e.g. "19.99"
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// String formats the amount with its currency, e.g. "19.99 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) MarshalGQL(w io.Writer) {
+	jsonB, _ := json.Marshal(map[string]string{
+		"amount":   m.Decimal(),
+		"currency": m.Currency,
+	})
+	w.Write(jsonB)
+}
+
+// UnmarshalGQL accepts {amount, currency}, or a bare amount in the default
+// currency. Amounts may be strings or numbers; strings are preferred since
+// they never pass through a float.
+func (m *Money) UnmarshalGQL(v any) error {
+	currency := DefaultCurrency()
+	amount := v
+
+	if fields, ok := v.(map[string]any); ok {
+		if c, ok := fields["currency"].(string); ok && c != "" {
+			currency = c
+		}
+		amount = fields["amount"]
+	}
+
+	var decimal string
+	switch a := amount.(type) {
+	case string:
+		decimal = a
+	case json.Number:
+		decimal = a.String()
+	case int:
+		decimal = strconv.Itoa(a)
+	case int64:
+		decimal = strconv.FormatInt(a, 10)
+	case float64:
+		decimal = strconv.FormatFloat(a, 'f', -1, 64)
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidAmount, amount)
+	}
+
+	parsed, err := ParseMoney(decimal, currency)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import "testing"
+
+func TestCurrencyExponent(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     int
+	}{
+		{"USD", 2},
+		{"KES", 2},
+		{"EUR", 2},
+		{"JPY", 0},
+		{"RWF", 0},
+		{"UGX", 0},
+		{"CLP", 0},
+		{"VND", 0},
+		{"XAF", 0},
+		{"XOF", 0},
+		{"XPF", 0},
+		{"BHD", 3},
+		{"KWD", 3},
+		{"JOD", 3},
+		{"TND", 3},
+	}
+	for _, test := range tests {
+		if got := CurrencyExponent(test.currency); got != test.want {
+			t.Errorf("CurrencyExponent(%s) = %d, want %d", test.currency, got, test.want)
+		}
+	}
+
+	for currency := range currencyExponents {
+		if !IsCurrency(currency) {
+			t.Errorf("%s has an exponent but is not a currency code", currency)
+		}
+	}
+}
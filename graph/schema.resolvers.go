@@ -6,26 +6,45 @@ package graph
 
 import (
 	"context"
+	"ecommerce-service/engine/addresses"
+	"ecommerce-service/engine/carts"
 	"ecommerce-service/engine/categories"
+	"ecommerce-service/engine/currencies"
+	"ecommerce-service/engine/inventory"
 	"ecommerce-service/engine/orders"
+	"ecommerce-service/engine/payments"
 	"ecommerce-service/engine/products"
+	"ecommerce-service/engine/promotions"
+	"ecommerce-service/engine/returns"
+	"ecommerce-service/engine/shipping"
+	"ecommerce-service/engine/tax"
 	"ecommerce-service/engine/users"
 	"ecommerce-service/graph/model"
 	"ecommerce-service/middleware"
 	"ecommerce-service/models"
-	"errors"
-	"fmt"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
 )
 
+// Ancestors is the resolver for the ancestors field.
+func (r *categoryResolver) Ancestors(ctx context.Context, obj *model.Category) ([]*model.Category, error) {
+	return categories.GetAncestors(obj.ID)
+}
+
+// Descendants is the resolver for the descendants field.
+func (r *categoryResolver) Descendants(ctx context.Context, obj *model.Category) ([]*model.Category, error) {
+	return categories.GetDescendants(obj.ID)
+}
+
 // UpdateProfile is the resolver for the updateProfile field.
 func (r *mutationResolver) UpdateProfile(ctx context.Context, input model.UpdateProfileInput) (*model.User, error) {
-	// Get the authenticated user ID from context
-	userID := ctx.Value("user").(string)
-	if userID == "" {
-		return nil, errors.New("unauthorized")
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
 	}
-	// Update user profile using the users package
-	return users.UpdateUserProfile(userID, input)
+
+	return users.UpdateUserProfile(user.ID.String(), input)
 }
 
 // PasswordResetRequest is the resolver for the PasswordResetRequest field.
@@ -40,12 +59,22 @@ func (r *mutationResolver) ResetPassword(ctx context.Context, input *model.Passw
 
 // CreateProduct is the resolver for the createProduct field.
 func (r *mutationResolver) CreateProduct(ctx context.Context, input model.ProductInput) (*model.Product, error) {
-	return products.CreateProduct(input)
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.CreateProduct(input, user.ID.String())
 }
 
 // UpdateProduct is the resolver for the updateProduct field.
 func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, input model.ProductInput) (*model.Product, error) {
-	return products.UpdateProduct(id, input)
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.UpdateProduct(id, input, user.ID.String())
 }
 
 // DeleteProduct is the resolver for the deleteProduct field.
@@ -53,6 +82,209 @@ func (r *mutationResolver) DeleteProduct(ctx context.Context, id string) (bool,
 	return products.DeleteProduct(id)
 }
 
+// AddProductOption is the resolver for the addProductOption field.
+func (r *mutationResolver) AddProductOption(ctx context.Context, productID string, input model.ProductOptionInput) (*model.Product, error) {
+	return products.AddProductOption(productID, input)
+}
+
+// CreateProductVariant is the resolver for the createProductVariant field.
+func (r *mutationResolver) CreateProductVariant(ctx context.Context, productID string, input model.ProductVariantInput) (*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.CreateProductVariant(productID, input, user.ID.String())
+}
+
+// UpdateProductVariant is the resolver for the updateProductVariant field.
+func (r *mutationResolver) UpdateProductVariant(ctx context.Context, id string, input model.ProductVariantInput) (*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.UpdateProductVariant(id, input, user.ID.String())
+}
+
+// DeleteProductVariant is the resolver for the deleteProductVariant field.
+func (r *mutationResolver) DeleteProductVariant(ctx context.Context, id string) (bool, error) {
+	return products.DeleteProductVariant(id)
+}
+
+// UploadProductImage is the resolver for the uploadProductImage field.
+func (r *mutationResolver) UploadProductImage(ctx context.Context, productID string, file graphql.Upload, altText *string, isPrimary *bool) (*model.ProductImage, error) {
+	return products.UploadProductImage(ctx, productID, file.File, altText, isPrimary)
+}
+
+// UpdateProductImage is the resolver for the updateProductImage field.
+func (r *mutationResolver) UpdateProductImage(ctx context.Context, id string, input model.ProductImageInput) (*model.ProductImage, error) {
+	return products.UpdateProductImage(id, input)
+}
+
+// DeleteProductImage is the resolver for the deleteProductImage field.
+func (r *mutationResolver) DeleteProductImage(ctx context.Context, id string) (bool, error) {
+	return products.DeleteProductImage(ctx, id)
+}
+
+// AdjustStock is the resolver for the adjustStock field.
+func (r *mutationResolver) AdjustStock(ctx context.Context, productID string, delta int32, reason model.InventoryReason, note *string, variantID *string) (*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory.AdjustStock(productID, variantID, int(delta), reason, note, user.ID.String())
+}
+
+// ReconcileStock is the resolver for the reconcileStock field.
+func (r *mutationResolver) ReconcileStock(ctx context.Context, productID string, note *string) (*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory.ReconcileStock(productID, note, user.ID.String())
+}
+
+// SetExchangeRate is the resolver for the setExchangeRate field.
+func (r *mutationResolver) SetExchangeRate(ctx context.Context, baseCurrency string, quoteCurrency string, rate string) (*model.ExchangeRate, error) {
+	return currencies.SetExchangeRate(baseCurrency, quoteCurrency, rate)
+}
+
+// CreatePromotion is the resolver for the createPromotion field.
+func (r *mutationResolver) CreatePromotion(ctx context.Context, input model.PromotionInput) (*model.Promotion, error) {
+	return promotions.CreatePromotion(input)
+}
+
+// SetPromotionActive is the resolver for the setPromotionActive field.
+func (r *mutationResolver) SetPromotionActive(ctx context.Context, id string, active bool) (*model.Promotion, error) {
+	return promotions.SetPromotionActive(id, active)
+}
+
+// SetTaxRate is the resolver for the setTaxRate field.
+func (r *mutationResolver) SetTaxRate(ctx context.Context, input model.TaxRateInput) (*model.TaxRate, error) {
+	return tax.SetTaxRate(input)
+}
+
+// DeleteTaxRate is the resolver for the deleteTaxRate field.
+func (r *mutationResolver) DeleteTaxRate(ctx context.Context, id string) (bool, error) {
+	return tax.DeleteTaxRate(id)
+}
+
+// AddAddress is the resolver for the addAddress field.
+func (r *mutationResolver) AddAddress(ctx context.Context, input model.AddressInput) (*model.Address, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return addresses.AddAddress(user.ID.String(), input)
+}
+
+// UpdateAddress is the resolver for the updateAddress field.
+func (r *mutationResolver) UpdateAddress(ctx context.Context, id string, input model.AddressInput) (*model.Address, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return addresses.UpdateAddress(user.ID.String(), id, input)
+}
+
+// DeleteAddress is the resolver for the deleteAddress field.
+func (r *mutationResolver) DeleteAddress(ctx context.Context, id string) (bool, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return addresses.DeleteAddress(user.ID.String(), id)
+}
+
+// CreateShippingMethod is the resolver for the createShippingMethod field.
+func (r *mutationResolver) CreateShippingMethod(ctx context.Context, input model.ShippingMethodInput) (*model.ShippingMethod, error) {
+	return shipping.CreateShippingMethod(input)
+}
+
+// SetShippingMethodActive is the resolver for the setShippingMethodActive field.
+func (r *mutationResolver) SetShippingMethodActive(ctx context.Context, id string, active bool) (*model.ShippingMethod, error) {
+	return shipping.SetShippingMethodActive(id, active)
+}
+
+// InitiatePayment is the resolver for the initiatePayment field.
+func (r *mutationResolver) InitiatePayment(ctx context.Context, orderID string, provider string, phoneNumber *string) (*model.PaymentSession, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments.InitiatePayment(ctx, orderID, user.ID.String(), provider, phoneNumber)
+}
+
+// ConfirmPayment is the resolver for the confirmPayment field.
+func (r *mutationResolver) ConfirmPayment(ctx context.Context, paymentID string) (*model.Payment, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Staff with order:read can confirm any customer's payment
+	anyPayment := middleware.RequirePermission(ctx, models.PermissionOrderRead) == nil
+
+	return payments.ConfirmPayment(ctx, paymentID, user.ID.String(), anyPayment)
+}
+
+// RefundPayment is the resolver for the refundPayment field.
+func (r *mutationResolver) RefundPayment(ctx context.Context, paymentID string, amount *model.Money, reason *string) (*model.Payment, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments.RefundPayment(ctx, paymentID, amount, reason, user.ID.String())
+}
+
+// RequestReturn is the resolver for the requestReturn field.
+func (r *mutationResolver) RequestReturn(ctx context.Context, input model.ReturnRequestInput) (*model.ReturnRequest, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return returns.RequestReturn(user.ID.String(), input)
+}
+
+// ApproveReturn is the resolver for the approveReturn field.
+func (r *mutationResolver) ApproveReturn(ctx context.Context, id string, note *string) (*model.ReturnRequest, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return returns.ApproveReturn(id, note, user.ID.String())
+}
+
+// RejectReturn is the resolver for the rejectReturn field.
+func (r *mutationResolver) RejectReturn(ctx context.Context, id string, note *string) (*model.ReturnRequest, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return returns.RejectReturn(id, note, user.ID.String())
+}
+
+// ReceiveReturn is the resolver for the receiveReturn field.
+func (r *mutationResolver) ReceiveReturn(ctx context.Context, id string, refundAmount *model.Money) (*model.ReturnRequest, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return returns.ReceiveReturn(ctx, id, refundAmount, user.ID.String())
+}
+
 // CreateCategory is the resolver for the createCategory field.
 func (r *mutationResolver) CreateCategory(ctx context.Context, input model.CategoryInput) (*model.Category, error) {
 	return categories.CreateCategory(input)
@@ -64,44 +296,219 @@ func (r *mutationResolver) UpdateCategory(ctx context.Context, id string, input
 }
 
 // DeleteCategory is the resolver for the deleteCategory field.
-func (r *mutationResolver) DeleteCategory(ctx context.Context, id string) (bool, error) {
-	panic(fmt.Errorf("not implemented: DeleteCategory - deleteCategory"))
+func (r *mutationResolver) DeleteCategory(ctx context.Context, id string, strategy model.CategoryDeleteStrategy) (bool, error) {
+	return categories.DeleteCategory(id, strategy)
 }
 
 // CreateOrder is the resolver for the createOrder field.
 func (r *mutationResolver) CreateOrder(ctx context.Context, input model.OrderInput) (*model.Order, error) {
-	user := ctx.Value("user").(string)
-	return orders.CreateOrder(input, user)
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return orders.CreateOrder(input, user.ID.String())
 }
 
 // UpdateOrderStatus is the resolver for the updateOrderStatus field.
-func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, id string, status model.OrderStatus) (*model.Order, error) {
-	// Verify user is admin
-	if err := middleware.RequireRole(ctx, models.RoleAdmin); err != nil {
+func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, id string, status model.OrderStatus, note *string) (*model.Order, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return orders.UpdateOrderStatus(id, status, user.ID.String(), note)
+}
+
+// AddToCart is the resolver for the addToCart field.
+func (r *mutationResolver) AddToCart(ctx context.Context, productID string, quantity int32, variantID *string) (*model.Cart, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	return orders.UpdateOrderStatus(id, status)
+	return carts.AddToCart(user.ID.String(), productID, variantID, int(quantity))
+}
+
+// UpdateCartItem is the resolver for the updateCartItem field.
+func (r *mutationResolver) UpdateCartItem(ctx context.Context, itemID string, quantity int32) (*model.Cart, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return carts.UpdateCartItem(user.ID.String(), itemID, int(quantity))
+}
+
+// RemoveFromCart is the resolver for the removeFromCart field.
+func (r *mutationResolver) RemoveFromCart(ctx context.Context, itemID string) (*model.Cart, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return carts.RemoveFromCart(user.ID.String(), itemID)
+}
+
+// CheckoutCart is the resolver for the checkoutCart field.
+func (r *mutationResolver) CheckoutCart(ctx context.Context, input *model.CheckoutInput) (*model.Order, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return carts.CheckoutCart(user.ID.String(), input)
+}
+
+// SuspendUser is the resolver for the suspendUser field.
+func (r *mutationResolver) SuspendUser(ctx context.Context, id string, reason *string) (*model.User, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return users.SuspendUser(id, reason, user)
+}
+
+// ReactivateUser is the resolver for the reactivateUser field.
+func (r *mutationResolver) ReactivateUser(ctx context.Context, id string) (*model.User, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return users.ReactivateUser(id, user)
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return users.DeleteUser(id, user)
+}
+
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, userID string, role model.Role) (*model.User, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return users.SetUserRole(userID, models.Role(role), user)
+}
+
+// SetRolePermissions is the resolver for the setRolePermissions field.
+func (r *mutationResolver) SetRolePermissions(ctx context.Context, role model.Role, permissions []model.Permission, description *string) (*model.RoleDefinition, error) {
+	granted := make([]models.Permission, len(permissions))
+	for i, permission := range permissions {
+		granted[i] = models.PermissionFromGraphQL(permission)
+	}
+
+	return users.SetRolePermissions(models.Role(role), granted, description)
+}
+
+// Images is the resolver for the images field.
+func (r *productResolver) Images(ctx context.Context, obj *model.Product) ([]*model.ProductImage, error) {
+	return products.GetProductImages(obj.ID)
+}
+
+// StockHistory is the resolver for the stockHistory field.
+func (r *productResolver) StockHistory(ctx context.Context, obj *model.Product, limit *int32) ([]*model.InventoryMovement, error) {
+	return inventory.GetStockHistory(obj.ID, limit)
 }
 
 // Profile is the resolver for the profile field.
 func (r *queryResolver) Profile(ctx context.Context) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: Profile - profile"))
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The user on the context was loaded when the request was authenticated;
+	// reload it so the profile reflects any changes made since
+	return users.FetchUserByID(user.ID.String())
 }
 
 // User is the resolver for the user field.
 func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: User - user"))
+	return users.FetchUserByID(id)
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, filter *model.UserFilter, first *int32, after *string) (*model.UserConnection, error) {
+	return users.GetUsers(filter, first, after)
 }
 
 // Products is the resolver for the products field.
-func (r *queryResolver) Products(ctx context.Context, categoryID *string, search *string) ([]*model.Product, error) {
-	return products.GetProducts(categoryID, search)
+func (r *queryResolver) Products(ctx context.Context, categoryID *string, search *string, currency *string, includeDescendants *bool) ([]*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	displayCurrency, err := currencies.DisplayCurrency(currency, user.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.GetProducts(categoryID, search, includeDescendants != nil && *includeDescendants, displayCurrency)
+}
+
+// ProductsConnection is the resolver for the productsConnection field.
+func (r *queryResolver) ProductsConnection(ctx context.Context, first *int32, after *string, orderBy *model.ProductOrder, filter *model.ProductFilter, currency *string) (*model.ProductConnection, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	displayCurrency, err := currencies.DisplayCurrency(currency, user.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.GetProductsConnection(first, after, orderBy, filter, displayCurrency)
 }
 
 // Product is the resolver for the product field.
-func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product, error) {
-	return products.GetProductByID(id)
+func (r *queryResolver) Product(ctx context.Context, id string, currency *string) (*model.Product, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	displayCurrency, err := currencies.DisplayCurrency(currency, user.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.GetProductByID(id, displayCurrency)
+}
+
+// SearchProducts is the resolver for the searchProducts field.
+func (r *queryResolver) SearchProducts(ctx context.Context, query string, first *int32, after *string, currency *string) (*model.ProductSearchConnection, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	displayCurrency, err := currencies.DisplayCurrency(currency, user.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	return products.SearchProducts(query, first, after, displayCurrency)
+}
+
+// ProductFacets is the resolver for the productFacets field.
+func (r *queryResolver) ProductFacets(ctx context.Context, search *string, categoryID *string, filter *model.ProductFilter, priceBoundaries []*model.Money) (*model.ProductFacets, error) {
+	if _, err := middleware.RequireAuth(ctx); err != nil {
+		return nil, err
+	}
+
+	return products.GetProductFacets(search, categoryID, filter, priceBoundaries)
 }
 
 // Categories is the resolver for the categories field.
@@ -109,33 +516,191 @@ func (r *queryResolver) Categories(ctx context.Context) ([]*model.Category, erro
 	return categories.GetCategories()
 }
 
+// CategoryTree is the resolver for the categoryTree field.
+func (r *queryResolver) CategoryTree(ctx context.Context) ([]*model.Category, error) {
+	return categories.GetCategoryTree()
+}
+
 // Category is the resolver for the category field.
 func (r *queryResolver) Category(ctx context.Context, id string) (*model.Category, error) {
 	return categories.GetCategoryByID(id)
 }
 
 // CategoryAveragePrice is the resolver for the categoryAveragePrice field.
-func (r *queryResolver) CategoryAveragePrice(ctx context.Context, id string) (float64, error) {
+func (r *queryResolver) CategoryAveragePrice(ctx context.Context, id string) (*model.Money, error) {
 	return products.GetCategoryAveragePrice(id)
 }
 
+// StockDiscrepancies is the resolver for the stockDiscrepancies field.
+func (r *queryResolver) StockDiscrepancies(ctx context.Context) ([]*model.StockDiscrepancy, error) {
+	return inventory.GetStockDiscrepancies()
+}
+
+// ExchangeRates is the resolver for the exchangeRates field.
+func (r *queryResolver) ExchangeRates(ctx context.Context) ([]*model.ExchangeRate, error) {
+	return currencies.GetExchangeRates()
+}
+
+// Promotions is the resolver for the promotions field.
+func (r *queryResolver) Promotions(ctx context.Context) ([]*model.Promotion, error) {
+	return promotions.GetPromotions()
+}
+
+// TaxRates is the resolver for the taxRates field.
+func (r *queryResolver) TaxRates(ctx context.Context, country *string) ([]*model.TaxRate, error) {
+	return tax.GetTaxRates(country)
+}
+
+// MyAddresses is the resolver for the myAddresses field.
+func (r *queryResolver) MyAddresses(ctx context.Context) ([]*model.Address, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return addresses.GetAddresses(user.ID.String())
+}
+
+// ShippingMethods is the resolver for the shippingMethods field.
+func (r *queryResolver) ShippingMethods(ctx context.Context, country string) ([]*model.ShippingMethod, error) {
+	return shipping.GetShippingMethods(country)
+}
+
+// PaymentProviders is the resolver for the paymentProviders field.
+func (r *queryResolver) PaymentProviders(ctx context.Context) ([]string, error) {
+	return payments.ProviderNames(), nil
+}
+
+// ReturnRequests is the resolver for the returnRequests field.
+func (r *queryResolver) ReturnRequests(ctx context.Context, status *model.ReturnStatus) ([]*model.ReturnRequest, error) {
+	return returns.GetReturnRequests(status)
+}
+
 // MyOrders is the resolver for the myOrders field.
 func (r *queryResolver) MyOrders(ctx context.Context) ([]*model.Order, error) {
-	user := ctx.Value("user").(string)
-	return orders.GetUserOrders(user)
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return orders.GetUserOrders(user.ID.String())
 }
 
 // Order is the resolver for the order field.
 func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
-	user := ctx.Value("user").(string)
-	return orders.GetOrder(id, user)
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Staff with order:read can see any customer's order
+	anyOrder := middleware.RequirePermission(ctx, models.PermissionOrderRead) == nil
+
+	return orders.GetOrder(id, user.ID.String(), anyOrder)
+}
+
+// MyCart is the resolver for the myCart field.
+func (r *queryResolver) MyCart(ctx context.Context) (*model.Cart, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return carts.GetCart(user.ID.String())
 }
 
+// RoleDefinitions is the resolver for the roleDefinitions field.
+func (r *queryResolver) RoleDefinitions(ctx context.Context) ([]*model.RoleDefinition, error) {
+	return users.GetRoleDefinitions()
+}
+
+// Names is the resolver for the names field.
+func (r *userResolver) Names(ctx context.Context, obj *model.User) (string, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return users.MaskNames(obj.Names), nil
+	}
+	return obj.Names, nil
+}
+
+// Email is the resolver for the email field.
+func (r *userResolver) Email(ctx context.Context, obj *model.User) (string, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return users.MaskEmail(obj.Email), nil
+	}
+	return obj.Email, nil
+}
+
+// PhoneNumber is the resolver for the phoneNumber field.
+func (r *userResolver) PhoneNumber(ctx context.Context, obj *model.User) (string, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return users.MaskPhoneNumber(obj.PhoneNumber), nil
+	}
+	return obj.PhoneNumber, nil
+}
+
+// LastLoginAt is the resolver for the lastLoginAt field.
+func (r *userResolver) LastLoginAt(ctx context.Context, obj *model.User) (*time.Time, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return nil, nil
+	}
+	return obj.LastLoginAt, nil
+}
+
+// OrderCount is the resolver for the orderCount field.
+func (r *userResolver) OrderCount(ctx context.Context, obj *model.User) (*int32, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return nil, nil
+	}
+
+	count, err := users.CountOrders(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
+// LifetimeSpend is the resolver for the lifetimeSpend field.
+func (r *userResolver) LifetimeSpend(ctx context.Context, obj *model.User) ([]*model.Money, error) {
+	if !middleware.CanViewUser(ctx, obj.ID) {
+		return nil, nil
+	}
+	return users.LifetimeSpend(obj.ID)
+}
+
+// Orders is the resolver for the orders field.
+func (r *userResolver) Orders(ctx context.Context, obj *model.User) ([]*model.Order, error) {
+	user, err := middleware.RequireAuth(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Staff with order:read can see any customer's orders
+	if user.ID.String() != obj.ID {
+		if err := middleware.RequirePermission(ctx, models.PermissionOrderRead); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders.GetUserOrders(obj.ID)
+}
+
+// Category returns CategoryResolver implementation.
+func (r *Resolver) Category() CategoryResolver { return &categoryResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Product returns ProductResolver implementation.
+func (r *Resolver) Product() ProductResolver { return &productResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type categoryResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type productResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestResolversRequireUser(t *testing.T) {
+	r := &Resolver{}
+	phone := "+254700000001"
+
+	contexts := map[string]context.Context{
+		"no user":      context.Background(),
+		"wrong type":   context.WithValue(context.Background(), "user", uuid.NewV4().String()),
+		"nil pointer":  context.WithValue(context.Background(), "user", (*models.User)(nil)),
+		"empty string": context.WithValue(context.Background(), "user", ""),
+	}
+
+	for name, ctx := range contexts {
+		t.Run(name, func(t *testing.T) {
+			if _, err := r.Mutation().UpdateProfile(ctx, model.UpdateProfileInput{PhoneNumber: &phone}); err == nil {
+				t.Error("updateProfile succeeded without a user")
+			}
+			if _, err := r.Mutation().CreateOrder(ctx, model.OrderInput{}); err == nil {
+				t.Error("createOrder succeeded without a user")
+			}
+			if _, err := r.Query().MyOrders(ctx); err == nil {
+				t.Error("myOrders succeeded without a user")
+			}
+			if _, err := r.Query().Profile(ctx); err == nil {
+				t.Error("profile succeeded without a user")
+			}
+		})
+	}
+}
+
+func TestResolversUseContextUser(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	r := &Resolver{}
+	user := utils.CreateTestCustomer(t)
+	ctx := context.WithValue(context.Background(), "user", user)
+
+	product := models.Product{
+		Name:  "Resolver Product",
+		Price: model.NewMoney(2500, model.DefaultCurrency()),
+		SKU:   "TEST-" + uuid.NewV4().String(),
+		Stock: 3,
+	}
+	if err := utils.DB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := r.Mutation().CreateOrder(ctx, model.OrderInput{
+		Items: []*model.OrderItemInput{{ProductID: product.ID.String(), Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	myOrders, err := r.Query().MyOrders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(myOrders) != 1 || myOrders[0].ID != order.ID {
+		t.Errorf("myOrders returned %d orders, want the one just placed", len(myOrders))
+	}
+
+	phone := "+254711111111"
+	updated, err := r.Mutation().UpdateProfile(ctx, model.UpdateProfileInput{PhoneNumber: &phone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != user.ID.String() {
+		t.Errorf("updated user %s, want %s", updated.ID, user.ID)
+	}
+
+	var stored models.User
+	if err := utils.DB.First(&stored, "id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.PhoneNumber != phone {
+		t.Errorf("phone number is %q, want %q", stored.PhoneNumber, phone)
+	}
+
+	// The context still holds the user as loaded before the update
+	profile, err := r.Query().Profile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.PhoneNumber != phone {
+		t.Errorf("profile phone number is %q, want the updated %q", profile.PhoneNumber, phone)
+	}
+}
@@ -2,16 +2,20 @@ package middleware
 
 import (
 	"context"
+	"ecommerce-service/graph/model"
 	"ecommerce-service/models"
 	"ecommerce-service/utils"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 )
 
 var (
@@ -93,6 +97,18 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
+		// A valid token doesn't let a suspended or deleted account back in
+		switch user.Status() {
+		case model.UserStatusSuspended:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account suspended",
+			})
+		case model.UserStatusDeleted:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account deleted",
+			})
+		}
+
 		// Add user to context
 		c.Locals("user", user)
 		return c.Next()
@@ -125,25 +141,102 @@ func getOrCreateUser(claims Claims) (*models.User, error) {
 
 // RequireAuth for GraphQL resolvers
 func RequireAuth(ctx context.Context) (*models.User, error) {
-	user := ctx.Value("user")
-	if user == nil {
+	user, ok := ctx.Value("user").(*models.User)
+	if !ok || user == nil {
 		return nil, errors.New("unauthorized")
 	}
-	return user.(*models.User), nil
+	return user, nil
+}
+
+type permissionsKey struct{}
+
+// requestPermissions holds the caller's role definition once a resolver has
+// checked a permission. Fields resolve concurrently, hence the sync.Once.
+type requestPermissions struct {
+	once       sync.Once
+	definition *models.RoleDefinition
+	err        error
 }
 
-// RequireRole for GraphQL resolvers
-func RequireRole(ctx context.Context, roles ...models.Role) error {
+// WithPermissions lets RequirePermission load the caller's role definition
+// once for the whole request instead of on every check
+func WithPermissions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, &requestPermissions{})
+}
+
+// roleDefinition loads the definition of the user's role, or nil if it has
+// none, reusing the request's copy when there is one
+func roleDefinition(ctx context.Context, user *models.User) (*models.RoleDefinition, error) {
+	load := func() (*models.RoleDefinition, error) {
+		var definition models.RoleDefinition
+		err := utils.DB.First(&definition, "role = ?", user.Role).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &definition, nil
+	}
+
+	cached, ok := ctx.Value(permissionsKey{}).(*requestPermissions)
+	if !ok {
+		return load()
+	}
+	cached.once.Do(func() {
+		cached.definition, cached.err = load()
+	})
+	return cached.definition, cached.err
+}
+
+// RequirePermission for GraphQL resolvers. The user's role must grant the
+// permission in its role definition; admins have every permission.
+func RequirePermission(ctx context.Context, permission models.Permission) error {
 	user, err := RequireAuth(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, role := range roles {
-		if user.Role == role {
-			return nil
-		}
+	if user.Role == models.RoleAdmin {
+		return nil
 	}
 
-	return errors.New("insufficient permissions")
+	definition, err := roleDefinition(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if definition == nil || !definition.HasPermission(permission) {
+		return errors.New("insufficient permissions")
+	}
+	return nil
+}
+
+// AuthDirective implements @auth
+func AuthDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if _, err := RequireAuth(ctx); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+// CanViewUser reports whether the viewer may see a user's personal
+// details: their own, or anyone's with user:read
+func CanViewUser(ctx context.Context, userID string) bool {
+	viewer, err := RequireAuth(ctx)
+	if err != nil {
+		return false
+	}
+	if viewer.ID.String() == userID {
+		return true
+	}
+	return RequirePermission(ctx, models.PermissionUserRead) == nil
+}
+
+// HasPermissionDirective implements @hasPermission
+func HasPermissionDirective(ctx context.Context, obj interface{}, next graphql.Resolver, permission model.Permission) (interface{}, error) {
+	if err := RequirePermission(ctx, models.PermissionFromGraphQL(permission)); err != nil {
+		return nil, err
+	}
+	return next(ctx)
 }
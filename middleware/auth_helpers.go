@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"context"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
 	"errors"
 	"time"
 )
@@ -48,11 +50,17 @@ func ExchangeCodeForToken(ctx context.Context, code string) (string, error) {
 	}
 
 	// Create or update user in database
-	_, err = getOrCreateUser(claims)
+	user, err := getOrCreateUser(claims)
 	if err != nil {
 		return "", err
 	}
 
+	// Exchanging the code is the sign-in; later requests only present the token
+	user.UpdateLoginTimestamp()
+	if err := utils.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("last_login_at", user.LastLoginAt).Error; err != nil {
+		return "", err
+	}
+
 	// Return the ID token
 	return rawIDToken, nil
 }
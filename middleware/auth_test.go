@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"ecommerce-service/models"
+	"ecommerce-service/utils"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRequirePermissionLoadsRoleOncePerRequest(t *testing.T) {
+	utils.OpenTestDB(t)
+
+	// A role of its own, so changing it can't affect other tests
+	definition := models.RoleDefinition{
+		Role:        models.Role("test-" + uuid.NewV4().String()[:8]),
+		Permissions: []models.Permission{models.PermissionInventoryWrite},
+	}
+	if err := utils.DB.Create(&definition).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Base: models.Base{ID: uuid.NewV4()}, Role: definition.Role}
+
+	ctx := WithPermissions(context.WithValue(context.Background(), "user", user))
+	if err := RequirePermission(ctx, models.PermissionInventoryWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := RequirePermission(ctx, models.PermissionOrderRead); err == nil {
+		t.Error("role was granted a permission it doesn't have")
+	}
+
+	// Take the permission away: the request keeps the definition it loaded,
+	// and the next request sees the change
+	definition.Permissions = []models.Permission{models.PermissionProductWrite}
+	if err := utils.DB.Select("permissions").Updates(&definition).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RequirePermission(ctx, models.PermissionInventoryWrite); err != nil {
+		t.Errorf("role definition was reloaded within the request: %v", err)
+	}
+
+	next := WithPermissions(context.WithValue(context.Background(), "user", user))
+	if err := RequirePermission(next, models.PermissionInventoryWrite); err == nil {
+		t.Error("a new request still has the removed permission")
+	}
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
-	// "context"
+	"context"
 	"ecommerce-service/graph/model"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 var (
@@ -22,73 +26,194 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Message)
 }
 
+// ValidationErrors collects every invalid field of an input, so a form can
+// show them all at once
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationErrors) add(field string, message string) {
+	*e = append(*e, &ValidationError{Field: field, Message: message})
+}
+
+// err returns nil when nothing was invalid, so callers don't get a non-nil
+// error holding an empty list
+func (e ValidationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
 // Validate product input
 func ValidateProductInput(input model.ProductInput) error {
+	var errs ValidationErrors
+
 	if strings.TrimSpace(input.Name) == "" {
-		return &ValidationError{Field: "name", Message: "cannot be empty"}
+		errs.add("name", "cannot be empty")
 	}
 
-	if input.Price <= 0 {
-		return &ValidationError{Field: "price", Message: "must be greater than 0"}
+	if input.Price.Amount <= 0 {
+		errs.add("price", "must be greater than 0")
 	}
 
 	if !skuRegex.MatchString(input.Sku) {
-		return &ValidationError{Field: "sku", Message: "invalid format"}
+		errs.add("sku", "invalid format")
 	}
 
 	if input.Stock < 0 {
-		return &ValidationError{Field: "stock", Message: "cannot be negative"}
+		errs.add("stock", "cannot be negative")
 	}
 
-	return nil
+	if input.Weight != nil && *input.Weight < 0 {
+		errs.add("weight", "cannot be negative")
+	}
+
+	return errs.err()
+}
+
+// Validate address input
+func ValidateAddressInput(input model.AddressInput) error {
+	var errs ValidationErrors
+
+	if strings.TrimSpace(input.Recipient) == "" {
+		errs.add("recipient", "cannot be empty")
+	}
+
+	if !phoneRegex.MatchString(input.PhoneNumber) {
+		errs.add("phoneNumber", "invalid phone number format")
+	}
+
+	if strings.TrimSpace(input.Line1) == "" {
+		errs.add("line1", "cannot be empty")
+	}
+
+	if strings.TrimSpace(input.City) == "" {
+		errs.add("city", "cannot be empty")
+	}
+
+	return errs.err()
 }
 
 // Validate category input
 func ValidateCategoryInput(input model.CategoryInput) error {
+	var errs ValidationErrors
+
 	if strings.TrimSpace(input.Name) == "" {
-		return &ValidationError{Field: "name", Message: "cannot be empty"}
+		errs.add("name", "cannot be empty")
 	}
 
-	return nil
+	return errs.err()
 }
 
 // Validate order input
 func ValidateOrderInput(input model.OrderInput) error {
+	var errs ValidationErrors
+
 	if len(input.Items) == 0 {
-		return &ValidationError{Field: "items", Message: "order must contain at least one item"}
+		errs.add("items", "order must contain at least one item")
 	}
 
 	for i, item := range input.Items {
 		if item.Quantity <= 0 {
-			return &ValidationError{
-				Field:   fmt.Sprintf("items[%d].quantity", i),
-				Message: "must be greater than 0",
-			}
+			errs.add(fmt.Sprintf("items[%d].quantity", i), "must be greater than 0")
 		}
 	}
 
-	return nil
+	return errs.err()
 }
 
 // Validate profile update input
 func ValidateUpdateProfileInput(input model.UpdateProfileInput) error {
+	var errs ValidationErrors
+
 	if input.PhoneNumber != nil {
 		if !phoneRegex.MatchString(*input.PhoneNumber) {
-			return &ValidationError{Field: "phoneNumber", Message: "invalid phone number format"}
+			errs.add("phoneNumber", "invalid phone number format")
 		}
 	}
 
 	if input.Country != nil {
 		if strings.TrimSpace(*input.Country) == "" {
-			return &ValidationError{Field: "country", Message: "cannot be empty"}
+			errs.add("country", "cannot be empty")
+		}
+	}
+
+	return errs.err()
+}
+
+// validateArgs runs the validator for each input argument of a field
+func validateArgs(args map[string]interface{}) error {
+	var errs ValidationErrors
+	for _, arg := range args {
+		var err error
+		switch input := arg.(type) {
+		case model.ProductInput:
+			err = ValidateProductInput(input)
+		case model.AddressInput:
+			err = ValidateAddressInput(input)
+		case model.CategoryInput:
+			err = ValidateCategoryInput(input)
+		case model.OrderInput:
+			err = ValidateOrderInput(input)
+		case model.UpdateProfileInput:
+			err = ValidateUpdateProfileInput(input)
+		}
+
+		var invalid ValidationErrors
+		if errors.As(err, &invalid) {
+			errs = append(errs, invalid...)
 		}
 	}
+	return errs.err()
+}
 
-	return nil
+// ValidateMutations is a field middleware that validates the arguments of
+// every mutation before its resolver runs
+func ValidateMutations(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc != nil && fc.Object == "Mutation" {
+		if err := validateArgs(fc.Args); err != nil {
+			return nil, err
+		}
+	}
+	return next(ctx)
 }
 
-// // Add validation directives to GraphQL schema
-// func ValidateDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
-//     // Implementation depends on your GraphQL framework
-//     return next(ctx)
-// }
+// PresentValidationError turns validation failures into a GraphQL error with
+// code VALIDATION_FAILED and the invalid fields under extensions.fields. It
+// returns nil for any other error.
+func PresentValidationError(ctx context.Context, err error) *gqlerror.Error {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		var single *ValidationError
+		if !errors.As(err, &single) {
+			return nil
+		}
+		errs = ValidationErrors{single}
+	}
+
+	fields := make([]map[string]interface{}, len(errs))
+	for i, fieldErr := range errs {
+		fields[i] = map[string]interface{}{
+			"field":   fieldErr.Field,
+			"message": fieldErr.Message,
+		}
+	}
+
+	return &gqlerror.Error{
+		Err:     err,
+		Message: "validation failed",
+		Path:    graphql.GetPath(ctx),
+		Extensions: map[string]interface{}{
+			"code":   "VALIDATION_FAILED",
+			"fields": fields,
+		},
+	}
+}
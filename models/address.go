@@ -0,0 +1,93 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"encoding/json"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// PostalAddress is the delivery part of an address. It is embedded in
+// Address and copied onto orders, so an order keeps the address it was
+// shipped to after the customer edits or deletes theirs.
+type PostalAddress struct {
+	Recipient   string
+	PhoneNumber string
+	Line1       string
+	Line2       string
+	City        string
+	Region      string
+	PostalCode  string
+	Country     string `gorm:"type:varchar(2)"` // ISO 3166 alpha-2
+}
+
+type Address struct {
+	Base
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Label  string    // e.g. "Home", "Office"
+	PostalAddress
+	IsDefault bool `gorm:"not null;default:false"`
+}
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	type AddressAlias Address
+	return json.Marshal(&struct {
+		AddressAlias
+		ID string `json:"id"`
+	}{
+		AddressAlias: AddressAlias(a),
+		ID:           a.ID.String(),
+	})
+}
+
+func (a Address) ToGraphQL() *model.Address {
+	address := &model.Address{
+		ID:          a.ID.String(),
+		Recipient:   a.Recipient,
+		PhoneNumber: a.PhoneNumber,
+		Line1:       a.Line1,
+		City:        a.City,
+		Country:     a.Country,
+		IsDefault:   a.IsDefault,
+		CreatedAt:   a.CreatedAt,
+	}
+	if a.Label != "" {
+		address.Label = &a.Label
+	}
+	if a.Line2 != "" {
+		address.Line2 = &a.Line2
+	}
+	if a.Region != "" {
+		address.Region = &a.Region
+	}
+	if a.PostalCode != "" {
+		address.PostalCode = &a.PostalCode
+	}
+	return address
+}
+
+// ToGraphQL returns nil for an empty address, as on orders placed before
+// addresses were recorded
+func (a PostalAddress) ToGraphQL() *model.PostalAddress {
+	if a.Line1 == "" {
+		return nil
+	}
+
+	address := &model.PostalAddress{
+		Recipient:   a.Recipient,
+		PhoneNumber: a.PhoneNumber,
+		Line1:       a.Line1,
+		City:        a.City,
+		Country:     a.Country,
+	}
+	if a.Line2 != "" {
+		address.Line2 = &a.Line2
+	}
+	if a.Region != "" {
+		address.Region = &a.Region
+	}
+	if a.PostalCode != "" {
+		address.PostalCode = &a.PostalCode
+	}
+	return address
+}
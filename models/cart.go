@@ -0,0 +1,66 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"encoding/json"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type Cart struct {
+	Base
+	UserID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex"`
+	User   User       `gorm:"foreignkey:UserID"`
+	Items  []CartItem `gorm:"foreignkey:CartID"`
+}
+
+type CartItem struct {
+	Base
+	// Unique per cart, product and variant; see idx_cart_items_cart_product_variant
+	CartID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	ProductID uuid.UUID `gorm:"type:uuid;not null"`
+	Product   Product
+	VariantID *uuid.UUID      `gorm:"type:uuid"`
+	Variant   *ProductVariant `gorm:"foreignkey:VariantID"`
+	Quantity  int             `gorm:"not null"`
+}
+
+func (c Cart) MarshalJSON() ([]byte, error) {
+	type CartAlias Cart
+	return json.Marshal(&struct {
+		CartAlias
+		ID string `json:"id"`
+	}{
+		CartAlias: CartAlias(c),
+		ID:        c.ID.String(),
+	})
+}
+
+// ToGraphQL converts the cart and its items. Total is left for the caller,
+// since items priced in different currencies need exchange rates to add up.
+func (c Cart) ToGraphQL() *model.Cart {
+	items := make([]*model.CartItem, len(c.Items))
+	for i, item := range c.Items {
+		items[i] = item.ToGraphQL()
+	}
+
+	return &model.Cart{
+		ID:        c.ID.String(),
+		Items:     items,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+func (ci CartItem) ToGraphQL() *model.CartItem {
+	item := &model.CartItem{
+		ID:       ci.ID.String(),
+		Product:  ci.Product.ToGraphQL(),
+		Quantity: int32(ci.Quantity),
+		SubTotal: ci.Product.Price.Mul(int64(ci.Quantity)),
+	}
+	if ci.Variant != nil {
+		item.Variant = ci.Variant.ToGraphQL(ci.Product)
+		item.SubTotal = ci.Variant.UnitPrice(ci.Product).Mul(int64(ci.Quantity))
+	}
+	return item
+}
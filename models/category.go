@@ -19,6 +19,11 @@ type Category struct {
 }
 
 func (c *Category) BeforeCreate(tx *gorm.DB) error {
+	// Shadows Base.BeforeCreate, so assign the ID here
+	if err := c.Base.BeforeCreate(tx); err != nil {
+		return err
+	}
+
 	if c.ParentID != nil {
 		var parent Category
 		if err := tx.First(&parent, "id = ?", c.ParentID).Error; err != nil {
@@ -46,9 +51,16 @@ func (c Category) ToGraphQL() *model.Category {
 	for i, child := range c.Children {
 		children[i] = child.ToGraphQL()
 	}
-	return &model.Category{
-		ID:       c.ID.String(),
-		Name:     c.Name,
-		Children: children,
+	category := &model.Category{
+		ID:        c.ID.String(),
+		Name:      c.Name,
+		Children:  children,
+		Level:     int32(c.Level),
+		CreatedAt: c.CreatedAt,
+	}
+	if c.ParentID != nil {
+		parentID := c.ParentID.String()
+		category.ParentID = &parentID
 	}
+	return category
 }
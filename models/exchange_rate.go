@@ -0,0 +1,25 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+)
+
+// ExchangeRate is the number of QuoteCurrency units one BaseCurrency unit
+// buys. Rates are kept as exact decimal strings so conversions never pass
+// through a float.
+type ExchangeRate struct {
+	Base
+	BaseCurrency  string `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair"`
+	QuoteCurrency string `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair"`
+	Rate          string `gorm:"type:numeric(20,10);not null"`
+}
+
+func (r ExchangeRate) ToGraphQL() *model.ExchangeRate {
+	return &model.ExchangeRate{
+		ID:            r.ID.String(),
+		BaseCurrency:  r.BaseCurrency,
+		QuoteCurrency: r.QuoteCurrency,
+		Rate:          r.Rate,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
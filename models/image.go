@@ -0,0 +1,40 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ProductImage is an uploaded product photo. Key and ThumbnailKey locate
+// the original and its thumbnail in the blob store.
+type ProductImage struct {
+	Base
+	ProductID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Key          string    `gorm:"not null"`
+	ThumbnailKey string    `gorm:"not null"`
+	ContentType  string    `gorm:"not null"`
+	Width        int       `gorm:"not null"`
+	Height       int       `gorm:"not null"`
+	AltText      string
+	Position     int  `gorm:"not null;default:0"`
+	IsPrimary    bool `gorm:"not null;default:false"`
+}
+
+// ToGraphQL takes the blob store's URL function to turn keys into links
+func (i ProductImage) ToGraphQL(url func(key string) string) *model.ProductImage {
+	image := &model.ProductImage{
+		ID:           i.ID.String(),
+		URL:          url(i.Key),
+		ThumbnailURL: url(i.ThumbnailKey),
+		Width:        int32(i.Width),
+		Height:       int32(i.Height),
+		Position:     int32(i.Position),
+		IsPrimary:    i.IsPrimary,
+		CreatedAt:    i.CreatedAt,
+	}
+	if i.AltText != "" {
+		image.AltText = &i.AltText
+	}
+	return image
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type InventoryReason string
+
+const (
+	InventoryReasonSale             InventoryReason = "SALE"
+	InventoryReasonCancellation     InventoryReason = "CANCELLATION"
+	InventoryReasonManualAdjustment InventoryReason = "MANUAL_ADJUSTMENT"
+	InventoryReasonReceipt          InventoryReason = "RECEIPT"
+	InventoryReasonReturn           InventoryReason = "RETURN"
+	// Ledger-only entry that brings the ledger in line with Product.Stock,
+	// e.g. the opening balance of a product created before the ledger existed
+	InventoryReasonReconciliation InventoryReason = "RECONCILIATION"
+)
+
+// IsManual reports whether admins may record this reason by hand. The rest
+// are only written by the order flow or by reconciliation.
+func (r InventoryReason) IsManual() bool {
+	switch r {
+	case InventoryReasonManualAdjustment, InventoryReasonReceipt, InventoryReasonReturn:
+		return true
+	}
+	return false
+}
+
+// InventoryMovement is a single entry in the stock ledger. Delta is positive
+// when units come back into stock and negative when they leave. Summing the
+// deltas for a product gives its expected stock.
+type InventoryMovement struct {
+	Base
+	ProductID   uuid.UUID       `gorm:"type:uuid;not null;index"`
+	Product     Product         `gorm:"foreignkey:ProductID"`
+	VariantID   *uuid.UUID      `gorm:"type:uuid;index"` // Set for products with variants
+	Delta       int             `gorm:"not null"`
+	Reason      InventoryReason `gorm:"not null;type:text"`
+	ReferenceID *uuid.UUID      `gorm:"type:uuid;index"`
+	ActorID     *uuid.UUID      `gorm:"type:uuid"`
+	Actor       *User           `gorm:"foreignkey:ActorID"`
+	Note        string
+}
+
+func (m InventoryMovement) ToGraphQL() *model.InventoryMovement {
+	movement := &model.InventoryMovement{
+		ID:        m.ID.String(),
+		Delta:     int32(m.Delta),
+		Reason:    model.InventoryReason(m.Reason),
+		CreatedAt: m.CreatedAt,
+	}
+
+	if m.VariantID != nil {
+		variantID := m.VariantID.String()
+		movement.VariantID = &variantID
+	}
+	if m.ReferenceID != nil {
+		referenceID := m.ReferenceID.String()
+		movement.ReferenceID = &referenceID
+	}
+	if m.Actor != nil {
+		movement.Actor = m.Actor.ToGraphData()
+	}
+	if m.Note != "" {
+		movement.Note = &m.Note
+	}
+
+	return movement
+}
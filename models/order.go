@@ -3,6 +3,8 @@ package models
 import (
 	"ecommerce-service/graph/model"
 	"encoding/json"
+	"math/big"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 )
@@ -16,13 +18,42 @@ const (
 	OrderStatusCancelled  OrderStatus = "CANCELLED"
 )
 
+// orderStatusTransitions lists the statuses each status may move to.
+// COMPLETED and CANCELLED are terminal.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusCompleted, OrderStatusCancelled},
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type Order struct {
 	Base
-	CustomerID uuid.UUID   `gorm:"type:uuid;not null"`
-	Customer   User        `gorm:"foreignkey:CustomerID"`
-	Items      []OrderItem `gorm:"foreignkey:OrderID"`
-	Status     OrderStatus `gorm:"not null;default:'PENDING'"`
-	Total      float64     `gorm:"not null"`
+	CustomerID    uuid.UUID       `gorm:"type:uuid;not null"`
+	Customer      User            `gorm:"foreignkey:CustomerID"`
+	Items         []OrderItem     `gorm:"foreignkey:OrderID"`
+	Status        OrderStatus     `gorm:"not null;default:'PENDING'"`
+	Subtotal      model.Money     `gorm:"embedded;embeddedPrefix:subtotal_"`
+	DiscountTotal model.Money     `gorm:"embedded;embeddedPrefix:discount_total_"`
+	Discounts     []OrderDiscount `gorm:"foreignkey:OrderID"`
+	TaxAmount     model.Money     `gorm:"embedded;embeddedPrefix:tax_amount_"` // Includes tax already inside inclusive prices
+	// Where and how the order ships, copied at checkout
+	ShippingAddress    PostalAddress `gorm:"embedded;embeddedPrefix:shipping_"`
+	ShippingMethodID   *uuid.UUID    `gorm:"type:uuid"`
+	ShippingMethodName string
+	ShippingCost       model.Money          `gorm:"embedded;embeddedPrefix:shipping_cost_"`
+	Total              model.Money          `gorm:"embedded;embeddedPrefix:total_"` // Total.Currency is the currency the order was placed in
+	StatusHistory      []OrderStatusHistory `gorm:"foreignkey:OrderID"`
+	Payments           []Payment            `gorm:"foreignkey:OrderID"`
+	Returns            []ReturnRequest      `gorm:"foreignkey:OrderID"`
+	RestockedAt        *time.Time           // Set once cancelled items have been returned to stock
 }
 
 type OrderItem struct {
@@ -30,9 +61,35 @@ type OrderItem struct {
 	OrderID   uuid.UUID `gorm:"type:uuid;not null"`
 	ProductID uuid.UUID `gorm:"type:uuid;not null"`
 	Product   Product
-	Quantity  int     `gorm:"not null"`
-	UnitPrice float64 `gorm:"not null"`
-	SubTotal  float64 `gorm:"not null"`
+	VariantID *uuid.UUID      `gorm:"type:uuid;index"`
+	Variant   *ProductVariant `gorm:"foreignkey:VariantID"`
+	Quantity  int             `gorm:"not null"`
+	UnitPrice model.Money     `gorm:"embedded;embeddedPrefix:unit_price_"`
+	SubTotal  model.Money     `gorm:"embedded;embeddedPrefix:sub_total_"`
+	// Catalogue price and the rate used to convert it into the order
+	// currency, locked in at checkout
+	BaseUnitPrice model.Money `gorm:"embedded;embeddedPrefix:base_unit_price_"`
+	ExchangeRate  string      `gorm:"type:numeric(20,10);not null;default:1"`
+	// This item's share of the order's discounts
+	DiscountAmount model.Money `gorm:"embedded;embeddedPrefix:discount_amount_"`
+	// Tax on SubTotal after any discount, at the rate for the customer's
+	// country. With TaxInclusive the tax is part of SubTotal, otherwise it
+	// is added to the order total.
+	TaxRate      string      `gorm:"type:numeric(7,4);not null;default:0"`
+	TaxAmount    model.Money `gorm:"embedded;embeddedPrefix:tax_amount_"`
+	TaxInclusive bool        `gorm:"not null;default:false"`
+}
+
+// OrderStatusHistory records a single status change on an order. FromStatus
+// is nil for the entry written when the order is created.
+type OrderStatusHistory struct {
+	Base
+	OrderID    uuid.UUID    `gorm:"type:uuid;not null;index"`
+	FromStatus *OrderStatus `gorm:"type:text"`
+	ToStatus   OrderStatus  `gorm:"not null;type:text"`
+	ActorID    *uuid.UUID   `gorm:"type:uuid"`
+	Actor      *User        `gorm:"foreignkey:ActorID"`
+	Note       string
 }
 
 func (o Order) MarshalJSON() ([]byte, error) {
@@ -52,22 +109,158 @@ func (o Order) ToGraphQL() *model.Order {
 		items[i] = item.ToGraphQL()
 	}
 
+	discounts := make([]*model.OrderDiscount, len(o.Discounts))
+	for i, discount := range o.Discounts {
+		discounts[i] = discount.ToGraphQL()
+	}
+
+	payments := make([]*model.Payment, len(o.Payments))
+	for i, payment := range o.Payments {
+		payments[i] = payment.ToGraphQL()
+	}
+
+	returns := make([]*model.ReturnRequest, len(o.Returns))
+	for i, request := range o.Returns {
+		returns[i] = request.ToGraphQL()
+	}
+
+	refundedAmount, refundStatus := o.refunds()
+
+	var shippingMethod *string
+	if o.ShippingMethodName != "" {
+		shippingMethod = &o.ShippingMethodName
+	}
+
+	history := make([]*model.OrderStatusChange, len(o.StatusHistory))
+	for i, change := range o.StatusHistory {
+		history[i] = change.ToGraphQL()
+	}
+
 	return &model.Order{
-		ID:        o.ID.String(),
-		Customer:  o.Customer.ToGraphData(),
-		Items:     items,
-		Status:    model.OrderStatus(o.Status),
-		Total:     o.Total,
-		CreatedAt: o.CreatedAt,
+		ID:              o.ID.String(),
+		Customer:        o.Customer.ToGraphData(),
+		Items:           items,
+		Status:          model.OrderStatus(o.Status),
+		Total:           o.Total,
+		Currency:        o.Total.Currency,
+		Subtotal:        o.Subtotal,
+		DiscountTotal:   o.DiscountTotal,
+		Discounts:       discounts,
+		TaxAmount:       o.TaxAmount,
+		TaxRate:         o.taxRate(),
+		ShippingAddress: o.ShippingAddress.ToGraphQL(),
+		ShippingMethod:  shippingMethod,
+		ShippingCost:    o.ShippingCost,
+		StatusHistory:   history,
+		Payments:        payments,
+		Returns:         returns,
+		RefundedAmount:  refundedAmount,
+		RefundStatus:    refundStatus,
+		CreatedAt:       o.CreatedAt,
 	}
 }
 
+// taxRate is the rate shared by every item, or nil if the items were taxed
+// at different rates
+func (o Order) taxRate() *string {
+	if len(o.Items) == 0 {
+		return nil
+	}
+
+	rate := formatPercent(o.Items[0].TaxRate)
+	for _, item := range o.Items[1:] {
+		if formatPercent(item.TaxRate) != rate {
+			return nil
+		}
+	}
+	return &rate
+}
+
+// refunds totals what has been refunded across the order's captured
+// payments. The order is REFUNDED once every captured payment has been
+// refunded in full.
+func (o Order) refunds() (model.Money, model.OrderRefundStatus) {
+	refunded := model.NewMoney(0, o.Total.Currency)
+	captured := 0
+	fullyRefunded := 0
+	for _, payment := range o.Payments {
+		if !payment.Status.IsCaptured() {
+			continue
+		}
+		captured++
+		if payment.Status == PaymentStatusRefunded {
+			fullyRefunded++
+		}
+		if sum, err := refunded.Add(payment.RefundedAmount); err == nil {
+			refunded = sum
+		}
+	}
+
+	switch {
+	case captured > 0 && fullyRefunded == captured:
+		return refunded, model.OrderRefundStatusRefunded
+	case refunded.Amount > 0:
+		return refunded, model.OrderRefundStatusPartiallyRefunded
+	}
+	return refunded, model.OrderRefundStatusNone
+}
+
+func (h OrderStatusHistory) ToGraphQL() *model.OrderStatusChange {
+	change := &model.OrderStatusChange{
+		ID:        h.ID.String(),
+		ToStatus:  model.OrderStatus(h.ToStatus),
+		CreatedAt: h.CreatedAt,
+	}
+
+	if h.FromStatus != nil {
+		from := model.OrderStatus(*h.FromStatus)
+		change.FromStatus = &from
+	}
+	if h.Actor != nil {
+		change.Actor = h.Actor.ToGraphData()
+	}
+	if h.Note != "" {
+		change.Note = &h.Note
+	}
+
+	return change
+}
+
+// PaidAmount is what the customer paid for quantity units of the item,
+// after its discount share and with any tax added on top. Used to price
+// refunds for returned units.
+func (oi OrderItem) PaidAmount(quantity int) (model.Money, error) {
+	paid, err := oi.SubTotal.Sub(oi.DiscountAmount)
+	if err != nil {
+		return model.Money{}, err
+	}
+	if !oi.TaxInclusive {
+		paid, err = paid.Add(oi.TaxAmount)
+		if err != nil {
+			return model.Money{}, err
+		}
+	}
+	if oi.Quantity == 0 {
+		return paid, nil
+	}
+	return paid.MulRat(big.NewRat(int64(quantity), int64(oi.Quantity))), nil
+}
+
 func (oi OrderItem) ToGraphQL() *model.OrderItem {
-	return &model.OrderItem{
-		ID:        oi.ID.String(),
-		Product:   oi.Product.ToGraphQL(),
-		Quantity:  int32(oi.Quantity),
-		UnitPrice: oi.UnitPrice,
-		SubTotal:  oi.SubTotal,
+	item := &model.OrderItem{
+		ID:            oi.ID.String(),
+		Product:       oi.Product.ToGraphQL(),
+		Quantity:      int32(oi.Quantity),
+		UnitPrice:     oi.UnitPrice,
+		SubTotal:      oi.SubTotal,
+		BaseUnitPrice: oi.BaseUnitPrice,
+		ExchangeRate:  oi.ExchangeRate,
+		TaxRate:       formatPercent(oi.TaxRate),
+		TaxAmount:     oi.TaxAmount,
+		TaxInclusive:  oi.TaxInclusive,
+	}
+	if oi.Variant != nil {
+		item.Variant = oi.Variant.ToGraphQL(oi.Product)
 	}
+	return item
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending           PaymentStatus = "PENDING"
+	PaymentStatusCaptured          PaymentStatus = "CAPTURED"
+	PaymentStatusFailed            PaymentStatus = "FAILED"
+	PaymentStatusPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+	PaymentStatusRefunded          PaymentStatus = "REFUNDED"
+)
+
+// IsCaptured reports whether money was collected, whether or not some of
+// it has since been refunded
+func (s PaymentStatus) IsCaptured() bool {
+	switch s {
+	case PaymentStatusCaptured, PaymentStatusPartiallyRefunded, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "PENDING"
+	RefundStatusSucceeded RefundStatus = "SUCCEEDED"
+	RefundStatusFailed    RefundStatus = "FAILED"
+)
+
+// Payment is one attempt to collect an order's total through a provider.
+// ProviderRef is the provider's id for the attempt (an M-Pesa
+// CheckoutRequestID, a Stripe PaymentIntent id) and is how webhooks find it.
+type Payment struct {
+	Base
+	OrderID        uuid.UUID     `gorm:"type:uuid;not null;index"`
+	Provider       string        `gorm:"not null;uniqueIndex:idx_payments_provider_ref"`
+	ProviderRef    *string       `gorm:"uniqueIndex:idx_payments_provider_ref"` // Nil until the provider accepts the request
+	Status         PaymentStatus `gorm:"not null;type:text"`
+	Amount         model.Money   `gorm:"embedded;embeddedPrefix:amount_"`
+	RefundedAmount model.Money   `gorm:"embedded;embeddedPrefix:refunded_amount_"`
+	Receipt        string        // Provider's receipt for the capture, e.g. the M-Pesa receipt number
+	FailureReason  string
+	CapturedAt     *time.Time
+	Refunds        []PaymentRefund `gorm:"foreignkey:PaymentID"`
+}
+
+type PaymentRefund struct {
+	Base
+	PaymentID     uuid.UUID    `gorm:"type:uuid;not null;index"`
+	ProviderRef   *string      `gorm:"index"`
+	Status        RefundStatus `gorm:"not null;type:text"`
+	Amount        model.Money  `gorm:"embedded;embeddedPrefix:amount_"`
+	Reason        string
+	FailureReason string
+	ActorID       *uuid.UUID `gorm:"type:uuid"`
+}
+
+func (p Payment) ToGraphQL() *model.Payment {
+	refunds := make([]*model.PaymentRefund, len(p.Refunds))
+	for i, refund := range p.Refunds {
+		refunds[i] = refund.ToGraphQL()
+	}
+
+	payment := &model.Payment{
+		ID:             p.ID.String(),
+		Provider:       p.Provider,
+		Status:         model.PaymentStatus(p.Status),
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		CapturedAt:     p.CapturedAt,
+		Refunds:        refunds,
+		CreatedAt:      p.CreatedAt,
+	}
+	if p.Receipt != "" {
+		payment.Receipt = &p.Receipt
+	}
+	if p.FailureReason != "" {
+		payment.FailureReason = &p.FailureReason
+	}
+	return payment
+}
+
+func (r PaymentRefund) ToGraphQL() *model.PaymentRefund {
+	refund := &model.PaymentRefund{
+		ID:        r.ID.String(),
+		Amount:    r.Amount,
+		Status:    model.RefundStatus(r.Status),
+		CreatedAt: r.CreatedAt,
+	}
+	if r.Reason != "" {
+		refund.Reason = &r.Reason
+	}
+	if r.FailureReason != "" {
+		refund.FailureReason = &r.FailureReason
+	}
+	return refund
+}
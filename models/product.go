@@ -9,10 +9,13 @@ type Product struct {
 	Base
 	Name        string `gorm:"not null"`
 	Description string
-	Price       float64    `gorm:"not null"`
-	SKU         string     `gorm:"uniqueIndex"`
-	Categories  []Category `gorm:"many2many:category_products;"`
-	Stock       int        `gorm:"not null;default:0"`
+	Price       model.Money      `gorm:"embedded;embeddedPrefix:price_"`
+	SKU         string           `gorm:"uniqueIndex"`
+	Categories  []Category       `gorm:"many2many:category_products;"`
+	Stock       int              `gorm:"not null;default:0"`
+	Weight      int              `gorm:"not null;default:0"` // Grams, for weight-based shipping
+	Options     []ProductOption  `gorm:"foreignkey:ProductID"`
+	Variants    []ProductVariant `gorm:"foreignkey:ProductID"`
 }
 
 func (p Product) MarshalJSON() ([]byte, error) {
@@ -35,14 +38,28 @@ func (p Product) ToGraphQL() *model.Product {
 		}
 	}
 
+	options := make([]*model.ProductOption, len(p.Options))
+	for i, option := range p.Options {
+		options[i] = option.ToGraphQL()
+	}
+
+	variants := make([]*model.ProductVariant, len(p.Variants))
+	for i, variant := range p.Variants {
+		variants[i] = variant.ToGraphQL(p)
+	}
+
 	return &model.Product{
 		ID:          p.ID.String(),
 		Name:        p.Name,
 		Description: &p.Description,
 		Price:       p.Price,
+		BasePrice:   p.Price,
 		Sku:         p.SKU,
 		Categories:  categories,
 		Stock:       int32(p.Stock),
+		Weight:      int32(p.Weight),
+		Options:     options,
+		Variants:    variants,
 		CreatedAt:   p.CreatedAt,
 	}
 }
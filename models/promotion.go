@@ -0,0 +1,140 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"encoding/json"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type PromotionType string
+
+const (
+	PromotionTypePercentage PromotionType = "PERCENTAGE"
+	PromotionTypeFixed      PromotionType = "FIXED"
+)
+
+type PromotionScope string
+
+const (
+	PromotionScopeOrder    PromotionScope = "ORDER"
+	PromotionScopeCategory PromotionScope = "CATEGORY"
+	PromotionScopeProduct  PromotionScope = "PRODUCT"
+)
+
+type Promotion struct {
+	Base
+	Code             string `gorm:"not null;uniqueIndex"` // Stored upper-case
+	Description      string
+	Type             PromotionType  `gorm:"not null;type:text"`
+	PercentOff       int            // Whole percent, for PERCENTAGE promotions
+	AmountOff        model.Money    `gorm:"embedded;embeddedPrefix:amount_off_"` // For FIXED promotions
+	Scope            PromotionScope `gorm:"not null;type:text"`
+	Categories       []Category     `gorm:"many2many:promotion_categories;"`
+	Products         []Product      `gorm:"many2many:promotion_products;"`
+	MinOrderValue    model.Money    `gorm:"embedded;embeddedPrefix:min_order_value_"` // Zero means no minimum
+	UsageLimit       *int           // Redemptions across all customers
+	PerCustomerLimit *int
+	StartsAt         *time.Time
+	EndsAt           *time.Time
+	Active           bool `gorm:"not null"`
+}
+
+// PromotionRedemption counts one use of a promotion towards its limits
+type PromotionRedemption struct {
+	Base
+	PromotionID uuid.UUID `gorm:"type:uuid;not null;index"`
+	CustomerID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	OrderID     uuid.UUID `gorm:"type:uuid;not null;index"`
+}
+
+// OrderDiscount is a discount line on an order. Code and Description are
+// copied so the line still reads correctly if the promotion changes.
+type OrderDiscount struct {
+	Base
+	OrderID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	PromotionID uuid.UUID `gorm:"type:uuid;not null"`
+	Code        string    `gorm:"not null"`
+	Description string
+	Amount      model.Money `gorm:"embedded;embeddedPrefix:amount_"`
+}
+
+func (p Promotion) MarshalJSON() ([]byte, error) {
+	type PromotionAlias Promotion
+	return json.Marshal(&struct {
+		PromotionAlias
+		ID string `json:"id"`
+	}{
+		PromotionAlias: PromotionAlias(p),
+		ID:             p.ID.String(),
+	})
+}
+
+func (p Promotion) ToGraphQL() *model.Promotion {
+	categories := make([]*model.Category, len(p.Categories))
+	for i, cat := range p.Categories {
+		categories[i] = &model.Category{
+			ID:   cat.ID.String(),
+			Name: cat.Name,
+		}
+	}
+
+	products := make([]*model.Product, len(p.Products))
+	for i, product := range p.Products {
+		products[i] = product.ToGraphQL()
+	}
+
+	promotion := &model.Promotion{
+		ID:               p.ID.String(),
+		Code:             p.Code,
+		Type:             model.PromotionType(p.Type),
+		Scope:            model.PromotionScope(p.Scope),
+		Categories:       categories,
+		Products:         products,
+		UsageLimit:       intPtrToInt32(p.UsageLimit),
+		PerCustomerLimit: intPtrToInt32(p.PerCustomerLimit),
+		StartsAt:         p.StartsAt,
+		EndsAt:           p.EndsAt,
+		Active:           p.Active,
+		CreatedAt:        p.CreatedAt,
+	}
+
+	if p.Description != "" {
+		promotion.Description = &p.Description
+	}
+	switch p.Type {
+	case PromotionTypePercentage:
+		percentOff := int32(p.PercentOff)
+		promotion.PercentOff = &percentOff
+	case PromotionTypeFixed:
+		amountOff := p.AmountOff
+		promotion.AmountOff = &amountOff
+	}
+	if !p.MinOrderValue.IsZero() {
+		minOrderValue := p.MinOrderValue
+		promotion.MinOrderValue = &minOrderValue
+	}
+
+	return promotion
+}
+
+func (d OrderDiscount) ToGraphQL() *model.OrderDiscount {
+	discount := &model.OrderDiscount{
+		ID:     d.ID.String(),
+		Code:   d.Code,
+		Amount: d.Amount,
+	}
+	if d.Description != "" {
+		discount.Description = &d.Description
+	}
+	return discount
+}
+
+func intPtrToInt32(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnStatusRequested ReturnStatus = "REQUESTED"
+	ReturnStatusApproved  ReturnStatus = "APPROVED"
+	ReturnStatusRejected  ReturnStatus = "REJECTED"
+	// Goods are back and restocked; the refund has not succeeded yet
+	ReturnStatusReceived ReturnStatus = "RECEIVED"
+	ReturnStatusRefunded ReturnStatus = "REFUNDED"
+)
+
+// ReturnRequest is a customer's request to send back some items of a
+// completed order
+type ReturnRequest struct {
+	Base
+	OrderID      uuid.UUID    `gorm:"type:uuid;not null;index"`
+	CustomerID   uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Status       ReturnStatus `gorm:"not null;type:text"`
+	Reason       string       `gorm:"not null"`
+	Items        []ReturnItem `gorm:"foreignkey:ReturnRequestID"`
+	AdminNote    string
+	ReviewedByID *uuid.UUID `gorm:"type:uuid"`
+	ReviewedAt   *time.Time
+	ReceivedAt   *time.Time
+	// Set when the goods are received
+	RefundAmount    model.Money    `gorm:"embedded;embeddedPrefix:refund_amount_"`
+	PaymentRefundID *uuid.UUID     `gorm:"type:uuid"`
+	PaymentRefund   *PaymentRefund `gorm:"foreignkey:PaymentRefundID"`
+}
+
+type ReturnItem struct {
+	Base
+	ReturnRequestID uuid.UUID `gorm:"type:uuid;not null;index"`
+	OrderItemID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	OrderItem       OrderItem `gorm:"foreignkey:OrderItemID"`
+	Quantity        int       `gorm:"not null"`
+}
+
+func (r ReturnRequest) ToGraphQL() *model.ReturnRequest {
+	items := make([]*model.ReturnItem, len(r.Items))
+	for i, item := range r.Items {
+		items[i] = &model.ReturnItem{
+			ID:        item.ID.String(),
+			OrderItem: item.OrderItem.ToGraphQL(),
+			Quantity:  int32(item.Quantity),
+		}
+	}
+
+	request := &model.ReturnRequest{
+		ID:         r.ID.String(),
+		OrderID:    r.OrderID.String(),
+		Status:     model.ReturnStatus(r.Status),
+		Reason:     r.Reason,
+		Items:      items,
+		ReviewedAt: r.ReviewedAt,
+		ReceivedAt: r.ReceivedAt,
+		CreatedAt:  r.CreatedAt,
+	}
+	if r.AdminNote != "" {
+		request.AdminNote = &r.AdminNote
+	}
+	if r.ReceivedAt != nil {
+		refundAmount := r.RefundAmount
+		request.RefundAmount = &refundAmount
+	}
+	if r.PaymentRefund != nil {
+		request.Refund = r.PaymentRefund.ToGraphQL()
+	}
+	return request
+}
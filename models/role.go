@@ -0,0 +1,125 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"strings"
+)
+
+// Permission allows one kind of action, named resource:action
+type Permission string
+
+const (
+	PermissionProductWrite   Permission = "product:write"
+	PermissionCategoryWrite  Permission = "category:write"
+	PermissionInventoryWrite Permission = "inventory:write"
+	PermissionOrderRead      Permission = "order:read"
+	PermissionOrderStatus    Permission = "order:status"
+	PermissionReturnManage   Permission = "return:manage"
+	PermissionPaymentRefund  Permission = "payment:refund"
+	PermissionPromotionWrite Permission = "promotion:write"
+	PermissionTaxWrite       Permission = "tax:write"
+	PermissionShippingWrite  Permission = "shipping:write"
+	PermissionCurrencyWrite  Permission = "currency:write"
+	PermissionUserRead       Permission = "user:read"
+	PermissionUserWrite      Permission = "user:write"
+	PermissionRoleManage     Permission = "role:manage"
+)
+
+// AllPermissions is every permission, which admins always have
+var AllPermissions = []Permission{
+	PermissionProductWrite,
+	PermissionCategoryWrite,
+	PermissionInventoryWrite,
+	PermissionOrderRead,
+	PermissionOrderStatus,
+	PermissionReturnManage,
+	PermissionPaymentRefund,
+	PermissionPromotionWrite,
+	PermissionTaxWrite,
+	PermissionShippingWrite,
+	PermissionCurrencyWrite,
+	PermissionUserRead,
+	PermissionUserWrite,
+	PermissionRoleManage,
+}
+
+func (p Permission) IsValid() bool {
+	for _, permission := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionFromGraphQL maps an enum value such as PRODUCT_WRITE to
+// product:write
+func PermissionFromGraphQL(p model.Permission) Permission {
+	return Permission(strings.ToLower(strings.Replace(string(p), "_", ":", 1)))
+}
+
+func (p Permission) ToGraphQL() model.Permission {
+	return model.Permission(strings.ToUpper(strings.Replace(string(p), ":", "_", 1)))
+}
+
+// RoleDefinition lists what a role may do. Admins are not limited by theirs.
+type RoleDefinition struct {
+	Base
+	Role        Role `gorm:"not null;type:text;uniqueIndex"`
+	Description string
+	Permissions []Permission `gorm:"serializer:json;type:jsonb;not null"`
+}
+
+// DefaultRoleDefinitions are created when missing, and can then be changed
+var DefaultRoleDefinitions = []RoleDefinition{
+	{
+		Role:        RoleAdmin,
+		Description: "Full access",
+		Permissions: AllPermissions,
+	},
+	{
+		Role:        RoleCatalogManager,
+		Description: "Manages products, categories and stock",
+		Permissions: []Permission{PermissionProductWrite, PermissionCategoryWrite, PermissionInventoryWrite},
+	},
+	{
+		Role:        RoleFulfillment,
+		Description: "Processes and completes orders",
+		Permissions: []Permission{PermissionOrderRead, PermissionOrderStatus, PermissionReturnManage},
+	},
+	{
+		Role:        RoleSupport,
+		Description: "Looks up orders and customers",
+		Permissions: []Permission{PermissionOrderRead, PermissionUserRead},
+	},
+	{
+		Role:        RoleUser,
+		Description: "Customer",
+		Permissions: []Permission{},
+	},
+}
+
+func (d *RoleDefinition) HasPermission(permission Permission) bool {
+	if d.Role == RoleAdmin {
+		return true
+	}
+	for _, p := range d.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *RoleDefinition) ToGraphQL() *model.RoleDefinition {
+	permissions := make([]model.Permission, len(d.Permissions))
+	for i, permission := range d.Permissions {
+		permissions[i] = permission.ToGraphQL()
+	}
+	return &model.RoleDefinition{
+		Role:        model.Role(d.Role),
+		Description: d.Description,
+		Permissions: permissions,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
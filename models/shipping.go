@@ -0,0 +1,75 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type ShippingRateType string
+
+const (
+	ShippingRateFlat         ShippingRateType = "FLAT"
+	ShippingRateWeightTiered ShippingRateType = "WEIGHT_TIERED"
+	ShippingRatePriceTiered  ShippingRateType = "PRICE_TIERED"
+)
+
+// ShippingMethod is a way of delivering to one country. FLAT methods
+// charge FlatRate; tiered methods charge the cost of the highest tier the
+// order's weight or value reaches.
+type ShippingMethod struct {
+	Base
+	Name          string             `gorm:"not null"`
+	Country       string             `gorm:"type:varchar(2);not null;index"` // ISO 3166 alpha-2
+	Type          ShippingRateType   `gorm:"not null;type:text"`
+	FlatRate      model.Money        `gorm:"embedded;embeddedPrefix:flat_rate_"`
+	Tiers         []ShippingRateTier `gorm:"foreignkey:ShippingMethodID"`
+	EstimatedDays *int
+	Active        bool `gorm:"not null"`
+}
+
+type ShippingRateTier struct {
+	Base
+	ShippingMethodID uuid.UUID   `gorm:"type:uuid;not null;index"`
+	MinWeight        int         // Grams, for WEIGHT_TIERED methods
+	MinOrderValue    model.Money `gorm:"embedded;embeddedPrefix:min_order_value_"` // For PRICE_TIERED methods
+	Cost             model.Money `gorm:"embedded;embeddedPrefix:cost_"`
+}
+
+func (m ShippingMethod) ToGraphQL() *model.ShippingMethod {
+	tiers := make([]*model.ShippingRateTier, len(m.Tiers))
+	for i, tier := range m.Tiers {
+		tiers[i] = tier.ToGraphQL(m.Type)
+	}
+
+	method := &model.ShippingMethod{
+		ID:            m.ID.String(),
+		Name:          m.Name,
+		Country:       m.Country,
+		Type:          model.ShippingRateType(m.Type),
+		Tiers:         tiers,
+		EstimatedDays: intPtrToInt32(m.EstimatedDays),
+		Active:        m.Active,
+		CreatedAt:     m.CreatedAt,
+	}
+	if m.Type == ShippingRateFlat {
+		flatRate := m.FlatRate
+		method.FlatRate = &flatRate
+	}
+	return method
+}
+
+func (t ShippingRateTier) ToGraphQL(rateType ShippingRateType) *model.ShippingRateTier {
+	tier := &model.ShippingRateTier{
+		Cost: t.Cost,
+	}
+	switch rateType {
+	case ShippingRateWeightTiered:
+		minWeight := int32(t.MinWeight)
+		tier.MinWeight = &minWeight
+	case ShippingRatePriceTiered:
+		minOrderValue := t.MinOrderValue
+		tier.MinOrderValue = &minOrderValue
+	}
+	return tier
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// TaxRate is a sales tax or VAT rate for a country. A rate with a CategoryID
+// applies only to products in that category and takes precedence over the
+// country's default rate (CategoryID nil).
+type TaxRate struct {
+	Base
+	Country    string     `gorm:"type:char(2);not null;index"` // ISO 3166 alpha-2
+	CategoryID *uuid.UUID `gorm:"type:uuid"`
+	Category   *Category  `gorm:"foreignkey:CategoryID"`
+	Name       string     `gorm:"not null"`                   // e.g. "VAT"
+	Rate       string     `gorm:"type:numeric(7,4);not null"` // Percent, e.g. "16"
+	// Whether catalogue prices in this country already include the tax
+	PricesIncludeTax bool `gorm:"not null;default:false"`
+}
+
+func (r TaxRate) ToGraphQL() *model.TaxRate {
+	rate := &model.TaxRate{
+		ID:               r.ID.String(),
+		Country:          r.Country,
+		Name:             r.Name,
+		Rate:             formatPercent(r.Rate),
+		PricesIncludeTax: r.PricesIncludeTax,
+		UpdatedAt:        r.UpdatedAt,
+	}
+	if r.Category != nil {
+		rate.Category = &model.Category{
+			ID:   r.Category.ID.String(),
+			Name: r.Category.Name,
+		}
+	}
+	return rate
+}
+
+// formatPercent drops the trailing zeros Postgres pads numeric columns
+// with, so "16.0000" reads as "16"
+func formatPercent(rate string) string {
+	if !strings.Contains(rate, ".") {
+		return rate
+	}
+	return strings.TrimSuffix(strings.TrimRight(rate, "0"), ".")
+}
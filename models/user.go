@@ -20,19 +20,36 @@ type User struct {
 	LastLoginAt         *time.Time
 	PasswordResetToken  string
 	PasswordResetExpiry *time.Time
+	SuspendedAt         *time.Time
+	SuspensionReason    string
 	Orders              []Order `gorm:"foreignKey:CustomerID"`
 }
 
+// Status is DELETED once the account is soft-deleted, whether or not it was
+// suspended first
+func (u *User) Status() model.UserStatus {
+	switch {
+	case u.DeletedAt != nil:
+		return model.UserStatusDeleted
+	case u.SuspendedAt != nil:
+		return model.UserStatusSuspended
+	}
+	return model.UserStatusActive
+}
+
 type Role string
 
 const (
-	RoleAdmin Role = "ADMIN"
-	RoleUser  Role = "USER"
+	RoleAdmin          Role = "ADMIN"
+	RoleCatalogManager Role = "CATALOG_MANAGER"
+	RoleFulfillment    Role = "FULFILLMENT"
+	RoleSupport        Role = "SUPPORT"
+	RoleUser           Role = "USER"
 )
 
 func (r Role) IsValid() bool {
 	switch r {
-	case RoleAdmin, RoleUser:
+	case RoleAdmin, RoleCatalogManager, RoleFulfillment, RoleSupport, RoleUser:
 		return true
 	}
 	return false
@@ -58,16 +75,23 @@ func (u *User) ComparePassword(password string) bool {
 }
 
 func (u *User) ToGraphData() *model.User {
-	return &model.User{
+	user := &model.User{
 		ID:          u.ID.String(),
 		Names:       u.Names,
 		Email:       u.Email,
-		Password:    u.Password,
 		PhoneNumber: u.PhoneNumber,
 		Country:     u.Country,
 		Role:        model.Role(u.Role),
+		Status:      u.Status(),
+		SuspendedAt: u.SuspendedAt,
+		LastLoginAt: u.LastLoginAt,
 		CreatedAt:   u.CreatedAt,
 	}
+	if u.SuspensionReason != "" {
+		reason := u.SuspensionReason
+		user.SuspensionReason = &reason
+	}
+	return user
 }
 
 func (u *User) GeneratePasswordResetToken() (string, error) {
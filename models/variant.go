@@ -0,0 +1,106 @@
+package models
+
+import (
+	"ecommerce-service/graph/model"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ProductOption is one way a product varies, e.g. Size or Colour
+type ProductOption struct {
+	Base
+	ProductID uuid.UUID            `gorm:"type:uuid;not null;index"`
+	Name      string               `gorm:"not null"`
+	Position  int                  `gorm:"not null;default:0"`
+	Values    []ProductOptionValue `gorm:"foreignkey:OptionID"`
+}
+
+type ProductOptionValue struct {
+	Base
+	OptionID uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Option   *ProductOption `gorm:"foreignkey:OptionID"`
+	Value    string         `gorm:"not null"`
+	Position int            `gorm:"not null;default:0"`
+}
+
+// ProductVariant is one sellable combination of a product's option values.
+// A product's Stock is the sum of its variants' stock once it has any.
+type ProductVariant struct {
+	Base
+	ProductID uuid.UUID `gorm:"type:uuid;not null;index"`
+	SKU       string    `gorm:"uniqueIndex"`
+	// Override the product's price when set; both are NULL when the
+	// product's price applies
+	PriceAmount   *int64
+	PriceCurrency *string              `gorm:"type:char(3)"`
+	Stock         int                  `gorm:"not null;default:0"`
+	OptionValues  []ProductOptionValue `gorm:"many2many:product_variant_option_values;"`
+}
+
+// PriceOverride is the variant's own price, or nil if it sells at the
+// product's
+func (v ProductVariant) PriceOverride() *model.Money {
+	if v.PriceAmount == nil || v.PriceCurrency == nil {
+		return nil
+	}
+	price := model.NewMoney(*v.PriceAmount, *v.PriceCurrency)
+	return &price
+}
+
+// SetPriceOverride gives the variant its own price, or clears it with nil
+func (v *ProductVariant) SetPriceOverride(price *model.Money) {
+	v.PriceAmount, v.PriceCurrency = nil, nil
+	if price != nil {
+		amount, currency := price.Amount, price.Currency
+		v.PriceAmount, v.PriceCurrency = &amount, &currency
+	}
+}
+
+// UnitPrice is the variant's catalogue price
+func (v ProductVariant) UnitPrice(product Product) model.Money {
+	if price := v.PriceOverride(); price != nil {
+		return *price
+	}
+	return product.Price
+}
+
+func (o ProductOption) ToGraphQL() *model.ProductOption {
+	values := make([]string, len(o.Values))
+	for i, value := range o.Values {
+		values[i] = value.Value
+	}
+
+	return &model.ProductOption{
+		ID:     o.ID.String(),
+		Name:   o.Name,
+		Values: values,
+	}
+}
+
+// ToGraphQL needs OptionValues.Option loaded to name the options
+func (v ProductVariant) ToGraphQL(product Product) *model.ProductVariant {
+	values := append([]ProductOptionValue(nil), v.OptionValues...)
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Option != nil && values[j].Option != nil &&
+			values[i].Option.Position < values[j].Option.Position
+	})
+
+	options := make([]*model.SelectedOption, len(values))
+	for i, value := range values {
+		options[i] = &model.SelectedOption{Value: value.Value}
+		if value.Option != nil {
+			options[i].Name = value.Option.Name
+		}
+	}
+
+	price := v.UnitPrice(product)
+	return &model.ProductVariant{
+		ID:        v.ID.String(),
+		Sku:       v.SKU,
+		Price:     price,
+		BasePrice: price,
+		Stock:     int32(v.Stock),
+		Options:   options,
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"crypto/rand"
+	"ecommerce-service/engine/media"
+	"ecommerce-service/engine/payments"
 	"ecommerce-service/graph"
 	"ecommerce-service/middleware"
 	"ecommerce-service/utils"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -39,8 +42,16 @@ func main() {
 	// Initialize database
 	utils.InitialiseDB()
 
+	// Register payment providers configured in the environment
+	payments.InitProviders()
+
+	// Storage for uploaded product images
+	media.InitStore()
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
+		// Room for an image upload plus the rest of the multipart form
+		BodyLimit: media.MaxUploadBytes + 1<<20,
 	})
 
 	// Security Middleware
@@ -70,6 +81,16 @@ func main() {
 	apiGroup.Use(middleware.AuthMiddleware())
 	apiGroup.All("/query", QueryHandler)
 
+	// Payment provider callbacks. These authenticate with the provider's
+	// own signature or token rather than a user session.
+	app.Post("/webhooks/payments/:provider", handlePaymentWebhook)
+
+	// Uploaded images and their thumbnails. File names are random, so they
+	// can be cached for good.
+	app.Static("/media", media.LocalRoot(), fiber.Static{
+		MaxAge: 365 * 24 * 60 * 60,
+	})
+
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.SendString("OK")
@@ -170,19 +191,29 @@ func handleCallback(c *fiber.Ctx) error {
 func QueryHandler(c *fiber.Ctx) error {
 	// Create new GraphQL server
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{
-		Resolvers:  &graph.Resolver{},
-		Directives: graph.DirectiveRoot{},
+		Resolvers: &graph.Resolver{},
+		Directives: graph.DirectiveRoot{
+			Auth:          middleware.AuthDirective,
+			HasPermission: middleware.HasPermissionDirective,
+		},
 	}))
 
+	// Validate mutation inputs before their resolvers run
+	srv.AroundFields(middleware.ValidateMutations)
+
 	// Add error handling
 	srv.SetErrorPresenter(func(ctx context.Context, e error) *gqlerror.Error {
-		err := graphql.DefaultErrorPresenter(ctx, e)
+		err := middleware.PresentValidationError(ctx, e)
+		if err == nil {
+			err = graphql.DefaultErrorPresenter(ctx, e)
+		}
 
 		if os.Getenv("ENV") != "production" {
 			// Include stack trace in development
-			err.Extensions = map[string]interface{}{
-				"stack": fmt.Sprintf("%+v", e),
+			if err.Extensions == nil {
+				err.Extensions = map[string]interface{}{}
 			}
+			err.Extensions["stack"] = fmt.Sprintf("%+v", e)
 		}
 
 		return err
@@ -193,6 +224,7 @@ func QueryHandler(c *fiber.Ctx) error {
 		// Add user from fiber context to request context
 		user := c.Locals("user")
 		ctx := context.WithValue(r.Context(), "user", user)
+		ctx = middleware.WithPermissions(ctx)
 		r = r.WithContext(ctx)
 
 		// Handle the request
@@ -203,6 +235,35 @@ func QueryHandler(c *fiber.Ctx) error {
 	return nil
 }
 
+func handlePaymentWebhook(c *fiber.Ctx) error {
+	var r http.Request
+	if err := fasthttpadaptor.ConvertRequest(c.Context(), &r, true); err != nil {
+		return err
+	}
+
+	err := payments.HandleWebhook(c.Params("provider"), &r)
+	switch {
+	case errors.Is(err, payments.ErrUnknownProvider):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, payments.ErrInvalidWebhook):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		// Providers retry failed deliveries
+		log.Printf("Payment webhook from %s failed: %v", c.Params("provider"), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "webhook processing failed",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"received": true,
+	})
+}
+
 func GraphqlHandler(c *fiber.Ctx) error {
 	playground := playground.Handler("GraphQL playground", "/api/query")
 	fasthttpadaptor.NewFastHTTPHandler(playground)(c.Context())
@@ -0,0 +1,31 @@
+package utils
+
+import "strings"
+
+// Country names customers commonly type, mapped to ISO 3166 alpha-2 codes
+var countryNames = map[string]string{
+	"KENYA":          "KE",
+	"UGANDA":         "UG",
+	"TANZANIA":       "TZ",
+	"RWANDA":         "RW",
+	"NIGERIA":        "NG",
+	"SOUTH AFRICA":   "ZA",
+	"UK":             "GB",
+	"UNITED KINGDOM": "GB",
+	"USA":            "US",
+	"UNITED STATES":  "US",
+	"GERMANY":        "DE",
+	"FRANCE":         "FR",
+	"NETHERLANDS":    "NL",
+}
+
+// NormalizeCountry turns User.Country, which holds whatever the customer
+// typed, into an upper-case ISO 3166 alpha-2 code where it can. Unknown
+// values are returned trimmed and upper-cased.
+func NormalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if code, ok := countryNames[country]; ok {
+		return code
+	}
+	return country
+}
@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"ecommerce-service/graph/model"
 	"ecommerce-service/models"
+	"fmt"
 	"log"
+	"math"
 	"os"
 
 	"gorm.io/driver/postgres"
@@ -27,14 +30,113 @@ func InitialiseDB() {
 
 	log.Print("Successfully connected to database!")
 
+	// Convert legacy float money columns before AutoMigrate sees the new schema
+	migrateMoneyColumns()
+
+	// Cart lines became unique per variant; the replacement index is created
+	// after AutoMigrate
+	if err := DB.Exec(`DROP INDEX IF EXISTS idx_cart_items_cart_product`).Error; err != nil {
+		panic(err)
+	}
+
 	// Setup models
 	setupModels(
 		&models.Category{},
 		&models.Product{},
+		&models.ProductOption{},
+		&models.ProductOptionValue{},
+		&models.ProductVariant{},
+		&models.ProductImage{},
 		&models.User{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.InventoryMovement{},
+		&models.ExchangeRate{},
+		&models.Promotion{},
+		&models.PromotionRedemption{},
+		&models.OrderDiscount{},
+		&models.TaxRate{},
+		&models.Address{},
+		&models.ShippingMethod{},
+		&models.ShippingRateTier{},
+		&models.Payment{},
+		&models.PaymentRefund{},
+		&models.ReturnRequest{},
+		&models.ReturnItem{},
+		&models.RoleDefinition{},
 	)
+
+	// Default roles; once created, admins can change their permissions
+	for _, definition := range models.DefaultRoleDefinitions {
+		if err := DB.Where("role = ?", definition.Role).FirstOrCreate(&definition).Error; err != nil {
+			panic(err)
+		}
+	}
+
+	// Variant prices became nullable overrides. Variants created without a
+	// price were stored at zero, which sold them for nothing; give them back
+	// the product's price.
+	for _, statement := range []string{
+		`ALTER TABLE product_variants
+			ALTER COLUMN price_amount DROP NOT NULL, ALTER COLUMN price_amount DROP DEFAULT,
+			ALTER COLUMN price_currency DROP NOT NULL, ALTER COLUMN price_currency DROP DEFAULT`,
+		`UPDATE product_variants SET price_amount = NULL, price_currency = NULL WHERE price_amount = 0`,
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			panic(err)
+		}
+	}
+
+	// A NULL variant_id must still clash with another NULL
+	if err := DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_cart_product_variant
+		ON cart_items (cart_id, product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'))`).Error; err != nil {
+		panic(err)
+	}
+
+	// Full-text search over products: a weighted tsvector kept up to date
+	// by Postgres, and trigram indexes for typo-tolerant name matching
+	for _, statement := range []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+			setweight(to_tsvector('simple', COALESCE(sku, '')), 'B') ||
+			setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)`,
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			panic(err)
+		}
+	}
+
+	// Orders placed before discounts existed have no subtotal
+	if err := DB.Exec(`UPDATE orders SET subtotal_amount = total_amount, subtotal_currency = total_currency
+		WHERE subtotal_amount = 0 AND discount_total_amount = 0 AND total_amount <> 0`).Error; err != nil {
+		panic(err)
+	}
+
+	// Orders placed before tax and shipping existed carry zero amounts in
+	// the column default currency; give them the order's currency instead
+	if err := DB.Exec(`UPDATE orders SET tax_amount_currency = total_currency
+		WHERE tax_amount_amount = 0 AND tax_amount_currency <> total_currency`).Error; err != nil {
+		panic(err)
+	}
+	if err := DB.Exec(`UPDATE order_items SET tax_amount_currency = sub_total_currency
+		WHERE tax_amount_amount = 0 AND tax_amount_currency <> sub_total_currency`).Error; err != nil {
+		panic(err)
+	}
+	if err := DB.Exec(`UPDATE order_items SET discount_amount_currency = sub_total_currency
+		WHERE discount_amount_amount = 0 AND discount_amount_currency <> sub_total_currency`).Error; err != nil {
+		panic(err)
+	}
+	if err := DB.Exec(`UPDATE orders SET shipping_cost_currency = total_currency
+		WHERE shipping_cost_amount = 0 AND shipping_cost_currency <> total_currency`).Error; err != nil {
+		panic(err)
+	}
 }
 
 func setupModels(models ...interface{}) {
@@ -43,3 +145,51 @@ func setupModels(models ...interface{}) {
 		panic(err)
 	}
 }
+
+// Float columns replaced by model.Money, keyed by table, mapped to the
+// prefix of the new amount/currency columns
+var legacyMoneyColumns = []struct {
+	Table  string
+	Column string
+	Prefix string
+}{
+	{"products", "price", "price_"},
+	{"orders", "total", "total_"},
+	{"order_items", "unit_price", "unit_price_"},
+	{"order_items", "sub_total", "sub_total_"},
+}
+
+// migrateMoneyColumns moves existing float amounts into integer minor units
+// in the default currency, rounding half away from zero, then drops the old
+// column. Columns that are already migrated are skipped.
+func migrateMoneyColumns() {
+	currency := model.DefaultCurrency()
+	scale := math.Pow10(model.CurrencyExponent(currency))
+	migrator := DB.Migrator()
+
+	for _, legacy := range legacyMoneyColumns {
+		if !migrator.HasTable(legacy.Table) || !migrator.HasColumn(legacy.Table, legacy.Column) {
+			continue
+		}
+
+		log.Printf("Migrating %s.%s to minor units (%s)", legacy.Table, legacy.Column, currency)
+
+		statements := []string{
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %samount bigint NOT NULL DEFAULT 0`, legacy.Table, legacy.Prefix),
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %scurrency char(3) NOT NULL DEFAULT 'USD'`, legacy.Table, legacy.Prefix),
+			fmt.Sprintf(`UPDATE %s SET %samount = ROUND(%s::numeric * %v), %scurrency = '%s'`, legacy.Table, legacy.Prefix, legacy.Column, scale, legacy.Prefix, currency),
+			fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, legacy.Table, legacy.Column),
+		}
+
+		tx := DB.Begin()
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				tx.Rollback()
+				panic(err)
+			}
+		}
+		if err := tx.Commit().Error; err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor identifies a row's position in a keyset-paginated list. CreatedAt and
+// ID always break ties so the ordering is stable; Value holds the sort key
+// when the list is ordered by something else.
+type Cursor struct {
+	Value     interface{} `json:"v,omitempty"`
+	CreatedAt time.Time   `json:"c"`
+	ID        string      `json:"i"`
+}
+
+func EncodeCursor(cursor Cursor) string {
+	jsonB, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(jsonB)
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	jsonB, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(jsonB, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// PageSize clamps the requested page size to [1, MaxPageSize]
+func PageSize(first *int32) int {
+	if first == nil || *first <= 0 {
+		return DefaultPageSize
+	}
+	if *first > MaxPageSize {
+		return MaxPageSize
+	}
+	return int(*first)
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"ecommerce-service/graph/model"
+	"ecommerce-service/models"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var testDBOnce sync.Once
+
+// OpenTestDB points DB at the database in TEST_DATABASE_URL and migrates
+// it, once per test binary. Tests that need a database are skipped when it
+// isn't set. The database should be a throwaway one: tests write to it and
+// don't clean up.
+func OpenTestDB(t testing.TB) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		os.Setenv("DATABASE_URL", dsn)
+		InitialiseDB()
+	})
+}
+
+// CreateTestCustomer adds a customer who can place orders: they have a
+// default address in a country of their own, shipped to for free, so orders
+// don't depend on other tests' data
+func CreateTestCustomer(t testing.TB) *models.User {
+	t.Helper()
+
+	suffix := uuid.NewV4().String()[:8]
+	country := "Z" + strings.ToUpper(suffix[:1])
+
+	user := models.User{
+		Names:       "Test Customer",
+		Email:       "customer-" + suffix + "@example.com",
+		PhoneNumber: "+254700000000",
+		Country:     country,
+		Role:        models.RoleUser,
+	}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	address := models.Address{
+		UserID: user.ID,
+		PostalAddress: models.PostalAddress{
+			Recipient: user.Names,
+			Line1:     "1 Test Street",
+			City:      "Testville",
+			Country:   country,
+		},
+		IsDefault: true,
+	}
+	if err := DB.Create(&address).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	method := models.ShippingMethod{
+		Name:     "Free " + suffix,
+		Country:  country,
+		Type:     models.ShippingRateFlat,
+		FlatRate: model.NewMoney(0, model.DefaultCurrency()),
+		Active:   true,
+	}
+	if err := DB.Create(&method).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return &user
+}